@@ -0,0 +1,113 @@
+// -------------------------------
+// Buffered channel: Fan In errors
+// -------------------------------
+
+// This is the fan out from channel_5.go, but instead of logging every error the caller gets one
+// error back for all the inserts.
+
+// Idea: The Goroutines still send a result for every insert. The receiving Goroutine appends the
+// error of every result to an errors.Multi. When the last result is in, Multi.Err is either nil or
+// one error that reads like "3 inserts failed: ...".
+
+// Multi is safe to append to from many Goroutines, so the workers could append directly. We keep
+// the result channel because the caller still wants to know about every insert that finished.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// result is what is sent back from each operation.
+type result struct {
+	id  int
+	op  string
+	err error
+}
+
+// ErrDeadlock is returned when the database gives up on an insert. It is the same value for every
+// insert, so the summary of Multi shows it once with the number of times it happened.
+var ErrDeadlock = errors.New("deadlock detected")
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+func main() {
+	if err := insertAll(10); err != nil {
+		log.Printf("ERR: %v", err)
+
+		// The members are still there for Is and As.
+		if errors.Is(err, ErrDeadlock) {
+			log.Println("At least one insert should be retried")
+		}
+		return
+	}
+
+	log.Println("Inserts Complete")
+}
+
+// insertAll fans out 2 inserts per Goroutine and returns one error for all of them.
+func insertAll(routines int) error {
+	inserts := routines * 2
+
+	// Buffered channel to receive information about any possible insert.
+	ch := make(chan result, inserts)
+
+	// Perform all the inserts. This is the fan out.
+	for i := 0; i < routines; i++ {
+		go func(id int) {
+			ch <- insertUser(id)
+			ch <- insertTrans(id)
+		}(i)
+	}
+
+	// This is the fan in. Append ignores nil so every result can be passed in.
+	m := errors.Multi{Op: "insert"}
+	for waitInserts := inserts; waitInserts > 0; waitInserts-- {
+		r := <-ch
+		log.Printf("N: %d ID: %d OP: %s", waitInserts, r.id, r.op)
+
+		m.Append(r.err)
+	}
+
+	// Return Err and not &m. When every call succeeded &m is an empty *Multi, and an error
+	// interface holding it is not nil, the trap in error_5.go. Err returns nil when m is empty.
+	return m.Err()
+}
+
+// insertUser simulates a database operation.
+func insertUser(id int) result {
+	r := result{
+		id: id,
+		op: fmt.Sprintf("insert USERS value (%d)", id),
+	}
+
+	// Randomize if the insert fails or not.
+	if rand.Intn(10) == 0 {
+		r.err = fmt.Errorf("Unable to insert %d into USER table", id)
+	}
+
+	return r
+}
+
+// insertTrans simulates a database operation.
+func insertTrans(id int) result {
+	r := result{
+		id: id,
+		op: fmt.Sprintf("insert TRANS value (%d)", id),
+	}
+
+	// Randomize if the insert fails or not. Wrapping keeps the cause, so every deadlock is grouped
+	// together in the summary.
+	if rand.Intn(5) == 0 {
+		r.err = errors.Wrap(ErrDeadlock, r.op)
+	}
+
+	return r
+}
@@ -0,0 +1,300 @@
+// -------------------------
+// Cancellation With Context
+// -------------------------
+
+// A nightly Copy can run for hours. When the deploy goes out or the operator hits Ctrl-C, we have
+// no way to tell it to stop, and we can't give it a deadline the way we did in
+// go/concurrency/context_3.go and context_4.go. Pull and Store don't take a context.Context.
+
+// We can't change Puller and Storer. Every Xenia and Pillar out there implements them. Instead, we
+// declare context aware variants next to them: PullerContext and StorerContext. This is what the
+// standard library did with database/sql (Query and QueryContext) and net (Dial and DialContext).
+
+// What about all the legacy implementations? They keep working unchanged. CopyContext still takes
+// a PullStorer and asks the concrete value inside for the context aware behavior:
+// - If it has it, we use it. No wrapper, no cost.
+// - Otherwise, we adapt it with AdaptPuller and AdaptStorer. A legacy call can't be interrupted, so
+//   the adapter checks ctx before every call and lets a call that already started finish. We don't
+//   walk away from it: a pull we walked away from would lose the record it was pulling, and a store
+//   could still land after we reported it as not stored. Cancellation waits for at most one call.
+
+// CopyContext checks for cancellation between every batch, and every call it makes gets the ctx.
+// When it stops early, it returns ctx.Err() together with the progress so far, so the caller knows
+// how much made it before the stop.
+
+// There is one exception. When ctx is done in the middle of a batch, the records pulled so far are
+// out of the source already. Storing them with ctx would fail straight away and lose them, for the
+// same reason we don't walk away from a legacy pull. So that last store gets a detached context:
+// it keeps the values of ctx but not its cancellation.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullerContext declares behavior for pulling data that can be cancelled.
+type PullerContext interface {
+	PullContext(ctx context.Context, d *Data) error
+}
+
+// StorerContext declares behavior for storing data that can be cancelled.
+type StorerContext interface {
+	StoreContext(ctx context.Context, d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+// It is a legacy implementation that knows nothing about context.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	if rand.Intn(50) == 0 {
+		return io.EOF
+	}
+
+	// Simulate the network.
+	time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+
+	d.Line = "Data"
+	fmt.Println("In:", d.Line)
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+// It has been updated to support context.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	return p.StoreContext(context.Background(), d)
+}
+
+// StoreContext knows how to store data into Pillar, giving up as soon as ctx is done.
+func (*Pillar) StoreContext(ctx context.Context, d *Data) error {
+	select {
+	case <-time.After(time.Duration(rand.Intn(20)) * time.Millisecond):
+		fmt.Println("Out:", d.Line)
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// legacyPuller adapts a Puller to the PullerContext interface.
+type legacyPuller struct {
+	p Puller
+}
+
+// PullContext knows how to pull data out of a legacy Puller, unless ctx is already done.
+func (lp legacyPuller) PullContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return lp.p.Pull(d)
+}
+
+// legacyStorer adapts a Storer to the StorerContext interface.
+type legacyStorer struct {
+	s Storer
+}
+
+// StoreContext knows how to store data into a legacy Storer, unless ctx is already done.
+func (ls legacyStorer) StoreContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ls.s.Store(d)
+}
+
+// AdaptPuller returns a PullerContext for any Puller.
+func AdaptPuller(p Puller) PullerContext {
+	if pc, ok := p.(PullerContext); ok {
+		return pc
+	}
+
+	return legacyPuller{p}
+}
+
+// AdaptStorer returns a StorerContext for any Storer.
+func AdaptStorer(s Storer) StorerContext {
+	if sc, ok := s.(StorerContext); ok {
+		return sc
+	}
+
+	return legacyStorer{s}
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// PullContext knows how to pull data out of the Puller of the System with cancellation, whether
+// the Puller supports it or not.
+func (s *System) PullContext(ctx context.Context, d *Data) error {
+	return AdaptPuller(s.Puller).PullContext(ctx, d)
+}
+
+// StoreContext knows how to store data into the Storer of the System with cancellation, whether
+// the Storer supports it or not.
+func (s *System) StoreContext(ctx context.Context, d *Data) error {
+	return AdaptStorer(s.Storer).StoreContext(ctx, d)
+}
+
+// Progress describes how far a CopyContext run got.
+type Progress struct {
+	Pulled int
+	Stored int
+}
+
+// pull knows how to pull bulks of data from any PullerContext.
+func pull(ctx context.Context, p PullerContext, data []Data) (int, error) {
+	for i := range data {
+		if err := p.PullContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any StorerContext.
+func store(ctx context.Context, s StorerContext, data []Data) (int, error) {
+	for i := range data {
+		if err := s.StoreContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// detached is a context that keeps the values of its parent but is never done.
+type detached struct {
+	context.Context
+}
+
+// Deadline reports there is no deadline.
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns nil, the context is never done.
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil, the context is never done.
+func (detached) Err() error {
+	return nil
+}
+
+// CopyContext knows how to pull and store data from any System until the data runs out or ctx
+// is done. The Progress is valid even when an error is returned.
+func CopyContext(ctx context.Context, ps PullStorer, batch int) (Progress, error) {
+	p := AdaptPuller(ps)
+	s := AdaptStorer(ps)
+
+	var prog Progress
+	data := make([]Data, batch)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return prog, err
+		}
+
+		i, err := pull(ctx, p, data)
+		prog.Pulled += i
+
+		if i > 0 {
+			// The records are out of the source, store them even when ctx is done by now.
+			sctx := ctx
+			if ctx.Err() != nil {
+				sctx = detached{ctx}
+			}
+
+			n, err := store(sctx, s, data[:i])
+			prog.Stored += n
+
+			if err != nil {
+				return prog, err
+			}
+		}
+
+		if err != nil {
+			return prog, err
+		}
+	}
+}
+
+func main() {
+	// Xenia knows nothing about context and Pillar does, System takes them both as they are.
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	// Give the whole run 100 milliseconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	prog, err := CopyContext(ctx, &sys, 3)
+	switch err {
+	case io.EOF:
+		fmt.Println("Copy complete")
+
+	case context.DeadlineExceeded, context.Canceled:
+		fmt.Println("Copy cancelled:", err)
+
+	default:
+		fmt.Println(err)
+	}
+
+	fmt.Printf("Pulled: %d Stored: %d\n", prog.Pulled, prog.Stored)
+}
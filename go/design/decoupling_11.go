@@ -0,0 +1,521 @@
+// -------------------
+// Metrics and Tracing
+// -------------------
+
+// The only observability we have in Copy is fmt.Println("In:") and fmt.Println("Out:"). When the
+// nightly job is slow at 3am, on-call has nothing to look at.
+
+// Remember what we said in error_6.go: we only log things that are actionable, anything else is
+// better suited on a dashboard through metrics. Here is what on-call needs:
+// - How many records went through each stage.
+// - How many errors each stage had, and of what kind.
+// - How long a batch takes in each stage, as a histogram, not an average.
+// - Optional spans around each batch so they can be tied into tracing.
+
+// We are not going to pick a metrics library for the whole company. We declare the behavior we
+// need with the Metrics and Tracer interfaces and let main decide what backs them. Registry is one
+// implementation that keeps everything in memory and can expose it both through expvar and in the
+// Prometheus text format.
+
+// Once again, we don't change Xenia, Pillar or the interfaces. InstrumentedPuller and
+// InstrumentedStorer wrap any Puller or Storer and count records and errors as they go by. Batches
+// only exist inside Copy, so the batch latency and the spans are recorded there, through optional
+// Hooks.
+
+// Errors are grouped by kind using behavior as context from error_4.go. We ask the concrete value
+// stored inside the error if it is Temporary or a Timeout, and never look at the string.
+
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Metrics declares behavior for recording what happens in a stage of the pipeline.
+type Metrics interface {
+	Count(name, stage, kind string, n int)
+	Observe(name, stage string, d time.Duration)
+}
+
+// Tracer declares behavior for starting a span.
+type Tracer interface {
+	Start(name string) Span
+}
+
+// Span declares behavior for finishing a span with the outcome of the work it covers.
+type Span interface {
+	End(records int, err error)
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(30) {
+	case 1:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		d.Line = "Data"
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// temporary is declared to test for the existence of the Temporary method.
+type temporary interface {
+	Temporary() bool
+}
+
+// timeout is declared to test for the existence of the Timeout method.
+type timeout interface {
+	Timeout() bool
+}
+
+// kind classifies an error for the error counters. errors.As finds the behavior even when the
+// error was wrapped on its way to us.
+func kind(err error) string {
+	var to timeout
+	if errors.As(err, &to) && to.Timeout() {
+		return "timeout"
+	}
+
+	var te temporary
+	if errors.As(err, &te) && te.Temporary() {
+		return "temporary"
+	}
+
+	return "permanent"
+}
+
+// InstrumentedPuller counts the records and errors of any Puller.
+type InstrumentedPuller struct {
+	Puller
+	Metrics Metrics
+}
+
+// Pull knows how to pull data out of the wrapped Puller and record the outcome.
+// io.EOF is the end of the data, not an error, so it is not counted.
+func (ip *InstrumentedPuller) Pull(d *Data) error {
+	err := ip.Puller.Pull(d)
+
+	switch {
+	case err == nil:
+		ip.Metrics.Count("records_total", "pull", "", 1)
+	case !errors.Is(err, io.EOF):
+		ip.Metrics.Count("errors_total", "pull", kind(err), 1)
+	}
+
+	return err
+}
+
+// InstrumentedStorer counts the records and errors of any Storer.
+type InstrumentedStorer struct {
+	Storer
+	Metrics Metrics
+}
+
+// Store knows how to store data into the wrapped Storer and record the outcome.
+func (is *InstrumentedStorer) Store(d *Data) error {
+	err := is.Storer.Store(d)
+
+	if err != nil {
+		is.Metrics.Count("errors_total", "store", kind(err), 1)
+		return err
+	}
+
+	is.Metrics.Count("records_total", "store", "", 1)
+	return nil
+}
+
+// Registry is an in memory implementation of Metrics. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	counters map[series]int64
+	hists    map[series]*histogram
+}
+
+// series identifies a single counter or histogram.
+type series struct {
+	name  string
+	stage string
+	kind  string
+}
+
+// buckets are the upper bounds of the latency histograms, in seconds.
+var buckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// histogram counts observations per bucket. counts[i] is the number of observations that were
+// less or equal to buckets[i]; the last element counts everything above the last bucket.
+type histogram struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// NewRegistry returns an empty Registry ready for use.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters: make(map[series]int64),
+		hists:    make(map[series]*histogram),
+	}
+}
+
+// Count adds n to the counter for the name, stage and kind.
+func (r *Registry) Count(name, stage, kind string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[series{name, stage, kind}] += int64(n)
+}
+
+// Observe records a duration in the histogram for the name and stage.
+func (r *Registry) Observe(name, stage string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := series{name: name, stage: stage}
+	h, ok := r.hists[s]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(buckets)+1)}
+		r.hists[s] = h
+	}
+
+	v := d.Seconds()
+	i := sort.SearchFloat64s(buckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// Publish exposes the registry under the given name at /debug/vars through expvar.
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(r.snapshot))
+}
+
+// snapshot returns a copy of the registry that expvar can encode as JSON.
+func (r *Registry) snapshot() interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := make(map[string]interface{})
+
+	for s, v := range r.counters {
+		snap[s.key()] = v
+	}
+
+	for s, h := range r.hists {
+		snap[s.key()] = map[string]interface{}{
+			"buckets": append([]int64(nil), h.counts...),
+			"sum":     h.sum,
+			"count":   h.count,
+		}
+	}
+
+	return snap
+}
+
+// key returns a flat name for expvar.
+func (s series) key() string {
+	k := s.name + "." + s.stage
+	if s.kind != "" {
+		k += "." + s.kind
+	}
+
+	return k
+}
+
+// labels returns the Prometheus labels for the series, with an extra le label if it is given.
+func (s series) labels(le string) string {
+	l := fmt.Sprintf("stage=%q", s.stage)
+	if s.kind != "" {
+		l += fmt.Sprintf(",kind=%q", s.kind)
+	}
+	if le != "" {
+		l += fmt.Sprintf(",le=%q", le)
+	}
+
+	return "{" + l + "}"
+}
+
+// WriteText writes the registry in the Prometheus text exposition format. Every metric name gets
+// the copy_ prefix.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Sort the series so the output is stable and every name is written in one block.
+	counters := make([]series, 0, len(r.counters))
+	for s := range r.counters {
+		counters = append(counters, s)
+	}
+	sortSeries(counters)
+
+	hists := make([]series, 0, len(r.hists))
+	for s := range r.hists {
+		hists = append(hists, s)
+	}
+	sortSeries(hists)
+
+	var last string
+	for _, s := range counters {
+		if s.name != last {
+			if _, err := fmt.Fprintf(w, "# TYPE copy_%s counter\n", s.name); err != nil {
+				return err
+			}
+			last = s.name
+		}
+
+		if _, err := fmt.Fprintf(w, "copy_%s%s %d\n", s.name, s.labels(""), r.counters[s]); err != nil {
+			return err
+		}
+	}
+
+	last = ""
+	for _, s := range hists {
+		if s.name != last {
+			if _, err := fmt.Fprintf(w, "# TYPE copy_%s histogram\n", s.name); err != nil {
+				return err
+			}
+			last = s.name
+		}
+
+		// Prometheus buckets are cumulative.
+		h := r.hists[s]
+		var cum int64
+		for i, c := range h.counts {
+			cum += c
+
+			le := "+Inf"
+			if i < len(buckets) {
+				le = fmt.Sprint(buckets[i])
+			}
+
+			if _, err := fmt.Fprintf(w, "copy_%s_bucket%s %d\n", s.name, s.labels(le), cum); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "copy_%s_sum%s %g\n", s.name, s.labels(""), h.sum); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "copy_%s_count%s %d\n", s.name, s.labels(""), h.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortSeries sorts by name, stage and kind.
+func sortSeries(ss []series) {
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].name != ss[j].name {
+			return ss[i].name < ss[j].name
+		}
+		if ss[i].stage != ss[j].stage {
+			return ss[i].stage < ss[j].stage
+		}
+		return ss[i].kind < ss[j].kind
+	})
+}
+
+// LogTracer is a Tracer that logs every span when it ends.
+type LogTracer struct {
+	Logger *log.Logger
+}
+
+// logSpan is the Span LogTracer hands out.
+type logSpan struct {
+	logger *log.Logger
+	name   string
+	start  time.Time
+}
+
+// Start begins a span.
+func (lt *LogTracer) Start(name string) Span {
+	return &logSpan{
+		logger: lt.Logger,
+		name:   name,
+		start:  time.Now(),
+	}
+}
+
+// End logs the span.
+func (ls *logSpan) End(records int, err error) {
+	ls.logger.Printf("span=%s records=%d duration=%v err=%v", ls.name, records, time.Since(ls.start), err)
+}
+
+// Hooks holds the optional observers for Copy. Any of them can be nil.
+type Hooks struct {
+	Metrics Metrics
+	Tracer  Tracer
+}
+
+// batch runs fn as one batch of the given stage, recording its latency and wrapping it in a span
+// when the hooks ask for it. io.EOF only says the data ran out, so the span ends without an error.
+func (h Hooks) batch(stage string, fn func() (int, error)) (int, error) {
+	var span Span
+	if h.Tracer != nil {
+		span = h.Tracer.Start(stage + "-batch")
+	}
+
+	start := time.Now()
+	n, err := fn()
+
+	if h.Metrics != nil {
+		h.Metrics.Observe("batch_seconds", stage, time.Since(start))
+	}
+
+	if span != nil {
+		serr := err
+		if errors.Is(serr, io.EOF) {
+			serr = nil
+		}
+		span.End(n, serr)
+	}
+
+	return n, err
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System, reporting every batch to the hooks.
+func Copy(ps PullStorer, batch int, h Hooks) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := h.batch("pull", func() (int, error) {
+			return pull(ps, data)
+		})
+
+		if i > 0 {
+			_, err := h.batch("store", func() (int, error) {
+				return store(ps, data[:i])
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	reg := NewRegistry()
+	reg.Publish("copy")
+
+	sys := System{
+		Puller: &InstrumentedPuller{
+			Puller: &Xenia{
+				Host:    "localhost:8000",
+				Timeout: time.Second,
+			},
+			Metrics: reg,
+		},
+		Storer: &InstrumentedStorer{
+			Storer: &Pillar{
+				Host:    "localhost:9000",
+				Timeout: time.Second,
+			},
+			Metrics: reg,
+		},
+	}
+
+	hooks := Hooks{
+		Metrics: reg,
+		Tracer: &LogTracer{
+			Logger: log.New(os.Stderr, "trace: ", 0),
+		},
+	}
+
+	if err := Copy(&sys, 3, hooks); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	// This is what a Prometheus scrape would see.
+	reg.WriteText(os.Stdout)
+}
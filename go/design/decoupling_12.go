@@ -0,0 +1,192 @@
+//go:build go1.18
+
+// ----------------------------------------
+// Decoupling the Data With Type Parameters
+// ----------------------------------------
+
+// Everything we built so far is hard-wired to one record type: Data with a single Line string.
+// The first time a team needs to copy users, or raw bytes, or maps, they copy-paste the whole file
+// and change the type. That is the same code over and over again with nothing but a different
+// type in it.
+
+// Interfaces decoupled us from the concrete systems we pull from and store into. Type parameters
+// (Go 1.18, notice the build tag at the top of the file) decouple us from the concrete data. We
+// keep the exact same design as decoupling_4.go, we just put a T on it:
+// - Puller[T] and Storer[T] still declare one behavior each.
+// - PullStorer[T] is still the composition of both.
+// - System[T] still embeds the two interfaces.
+// - pull, store and Copy still don't care what is stored inside the interfaces.
+
+// Notice that T is only constrained by any. Copy never looks at a record, it moves them. The
+// moment we would need to, say, compare records, that is when we would reach for a tighter
+// constraint.
+
+// At the call site, we have to name the type: Copy[User](&sys, 3). The compiler can infer T from
+// a []T or a *T, but not from a value that only happens to implement PullStorer[T]. Inside Copy,
+// pull and store get T from the data slice, so they read exactly like they did before.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Puller declares behavior for pulling data of any type.
+type Puller[T any] interface {
+	Pull(d *T) error
+}
+
+// Storer declares behavior for storing data of any type.
+type Storer[T any] interface {
+	Store(d *T) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer[T any] interface {
+	Puller[T]
+	Storer[T]
+}
+
+// Xenia is a system we need to pull data from. It can hold records of any type.
+type Xenia[T any] struct {
+	Host    string
+	Timeout time.Duration
+	Records []T
+
+	pos int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia[T]) Pull(d *T) error {
+	if x.pos >= len(x.Records) {
+		return io.EOF
+	}
+
+	*d = x.Records[x.pos]
+	x.pos++
+
+	fmt.Printf("In: %v\n", *d)
+	return nil
+}
+
+// Pillar is a system we need to store data into. It can hold records of any type.
+type Pillar[T any] struct {
+	Host    string
+	Timeout time.Duration
+	Records []T
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar[T]) Store(d *T) error {
+	p.Records = append(p.Records, *d)
+
+	fmt.Printf("Out: %v\n", *d)
+	return nil
+}
+
+// System wraps Pullers and Stores of the same type together into a single system.
+type System[T any] struct {
+	Puller[T]
+	Storer[T]
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull[T any](p Puller[T], data []T) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store[T any](s Storer[T], data []T) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data of any type from any System.
+func Copy[T any](ps PullStorer[T], batch int) error {
+	data := make([]T, batch)
+
+	for {
+		i, err := pull[T](ps, data)
+		if i > 0 {
+			if _, err := store[T](ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// User is a struct record.
+type User struct {
+	Name  string
+	Email string
+}
+
+func main() {
+	// Copy structs.
+	users := System[User]{
+		Puller: &Xenia[User]{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+			Records: []User{{"Bill", "bill@email.com"}, {"Jill", "jill@email.com"}},
+		},
+		Storer: &Pillar[User]{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy[User](&users, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	// Copy byte slices.
+	raw := System[[]byte]{
+		Puller: &Xenia[[]byte]{
+			Host:    "localhost:8001",
+			Timeout: time.Second,
+			Records: [][]byte{[]byte("abc"), []byte("def")},
+		},
+		Storer: &Pillar[[]byte]{
+			Host:    "localhost:9001",
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy[[]byte](&raw, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	// Copy maps.
+	docs := System[map[string]string]{
+		Puller: &Xenia[map[string]string]{
+			Host:    "localhost:8002",
+			Timeout: time.Second,
+			Records: []map[string]string{{"id": "1"}, {"id": "2"}, {"id": "3"}, {"id": "4"}},
+		},
+		Storer: &Pillar[map[string]string]{
+			Host:    "localhost:9002",
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy[map[string]string](&docs, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,326 @@
+// ------------------------------
+// Rate Limiting and Backpressure
+// ------------------------------
+
+// store hammers Pillar as fast as pull can hand it data. Pillar has a quota, and so does every
+// other system we store into. When we go over it, we get throttled or, worse, we take it down.
+
+// Two separate problems, two separate pieces of behavior:
+
+// 1. How fast can we call Store?
+// A TokenBucket holds up to Burst tokens and refills at Rate tokens per second. Every call to Wait
+// takes a token, and blocks until there is one. LimitedStorer wraps any Storer and waits on its
+// bucket before every Store. Each target gets its own bucket, so the quota is configured per
+// target in main.
+
+// 2. What happens to the data while we wait?
+// We want the pullers to keep working while the storer catches up, but not forever. If we buffer
+// without a limit, a slow target means unbounded memory. QueuedStorer puts a bounded channel in
+// front of any Storer. Store only puts the record on the queue and returns, so pull keeps going.
+// When the queue is full, the send blocks. Copy is blocked inside Store, so it stops calling Pull.
+// That is backpressure: the slowest part of the pipeline sets the pace all the way back to the
+// source, with at most Size records in flight.
+
+//   pull --> store --> [ queue of Size ] --> Goroutine --> LimitedStorer --> Pillar
+//                 <-------- blocks when full     waits on the TokenBucket
+
+// Because the real store happens on another Goroutine, a failure can't be returned from the Store
+// call that queued the record. QueuedStorer remembers the first one and reports it from the next
+// Store and from Close, which also waits for the queue to drain.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	Records int
+
+	pos int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if x.pos >= x.Records {
+		return io.EOF
+	}
+
+	d.Line = fmt.Sprintf("Data %d", x.pos)
+	x.pos++
+
+	fmt.Println("In:", d.Line)
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// TokenBucket limits how often something can happen. It is safe for concurrent use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket that refills at rate tokens per second and holds at most
+// burst tokens. Like time.NewTicker with a non-positive interval, it panics when rate is not
+// positive: such a bucket never refills and Wait would have to wait forever.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if rate <= 0 {
+		panic("non-positive rate for NewTokenBucket")
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it. Tokens can
+// go negative, which is how callers waiting at the same time line up behind each other.
+func (tb *TokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// Wait blocks until a token is available.
+func (tb *TokenBucket) Wait() {
+	if d := tb.reserve(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// LimitedStorer wraps any Storer with a TokenBucket.
+type LimitedStorer struct {
+	Storer
+	Bucket *TokenBucket
+}
+
+// Store knows how to store data into the wrapped Storer without going over its rate.
+func (ls *LimitedStorer) Store(d *Data) error {
+	ls.Bucket.Wait()
+	return ls.Storer.Store(d)
+}
+
+// ErrClosed is returned when storing into a QueuedStorer that was closed.
+var ErrClosed = errors.New("queued storer is closed")
+
+// QueuedStorer stores records into the wrapped Storer on its own Goroutine, holding at most a
+// bounded number of records while it catches up.
+type QueuedStorer struct {
+	queue chan Data
+	done  chan struct{}
+
+	// sendMu is held for reading while sending on queue and for writing to close it, so Close
+	// can't close the queue under a Store that is blocked on the send.
+	sendMu sync.RWMutex
+	closed bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewQueuedStorer starts a QueuedStorer in front of s that holds at most size records.
+func NewQueuedStorer(s Storer, size int) *QueuedStorer {
+	qs := QueuedStorer{
+		queue: make(chan Data, size),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(qs.done)
+
+		for d := range qs.queue {
+			// Every record gets its own variable, the Storer may keep the pointer.
+			d := d
+			if err := s.Store(&d); err != nil {
+				qs.mu.Lock()
+				if qs.err == nil {
+					qs.err = err
+				}
+				qs.mu.Unlock()
+			}
+		}
+	}()
+
+	return &qs
+}
+
+// Store knows how to queue a record. It blocks while the queue is full.
+func (qs *QueuedStorer) Store(d *Data) error {
+	qs.sendMu.RLock()
+	defer qs.sendMu.RUnlock()
+
+	if qs.closed {
+		return ErrClosed
+	}
+
+	qs.mu.Lock()
+	err := qs.err
+	qs.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// We send a copy, the caller is going to reuse d for the next pull.
+	qs.queue <- *d
+	return nil
+}
+
+// Close stops accepting records, waits until every queued record has been stored and returns
+// the first store error. A Store blocked on a full queue when Close is called still gets its
+// record queued, the ones called after return ErrClosed.
+func (qs *QueuedStorer) Close() error {
+	qs.sendMu.Lock()
+	if !qs.closed {
+		qs.closed = true
+		close(qs.queue)
+	}
+	qs.sendMu.Unlock()
+
+	<-qs.done
+
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	return qs.err
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	// Pillar allows 20 stores a second with bursts of 5. We never hold more than 4 records
+	// waiting for it.
+	qs := NewQueuedStorer(
+		&LimitedStorer{
+			Storer: &Pillar{
+				Host:    "localhost:9000",
+				Timeout: time.Second,
+			},
+			Bucket: NewTokenBucket(20, 5),
+		},
+		4,
+	)
+
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+			Records: 20,
+		},
+		Storer: qs,
+	}
+
+	start := time.Now()
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	if err := qs.Close(); err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println("Elapsed:", time.Since(start).Round(10*time.Millisecond))
+}
@@ -0,0 +1,334 @@
+// ---------------------------
+// Fan Out to Multiple Storers
+// ---------------------------
+
+// System embeds exactly one Storer. More and more often, the same data has to land in several
+// places: the primary store, an audit log and a cache. They don't all matter the same way:
+// - The primary store must succeed, or the record is not stored.
+// - The audit log must succeed too, but any 2 out of our 3 replicas is good enough. That is a
+//   quorum.
+// - The cache is best effort. If it is down, we still count the record as stored.
+
+// MultiStorer is a new concrete type that implements Storer, so System and Copy don't change. It
+// holds a list of targets, each with its own policy, and sends the record to all of them at the
+// same time, one Goroutine per target. It waits for every outcome and then applies the policies.
+
+// How does Copy find out what happened? A bare error is not enough. A failed cache write and a
+// failed primary write both produce an error, but only one of them means the record was not
+// stored. So MultiStorer returns a FanoutError that carries the outcome of every target, and that
+// has a Stored method.
+// Copy doesn't type assert to FanoutError. It asks the error for the behavior it cares about, just
+// like we did with Temporary in error_4.go: "are you an error that still counts as stored?".
+// Any other Storer can return an error with the same behavior and Copy handles it the same way.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+// FailRate is the chance, out of 10, that a store fails.
+type Pillar struct {
+	Host     string
+	Timeout  time.Duration
+	FailRate int
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	if rand.Intn(10) < p.FailRate {
+		return errors.New("Error storing data into " + p.Host)
+	}
+
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Policy decides how the failure of a target affects the outcome of a store.
+type Policy int
+
+// Set of policies a target can have.
+const (
+	// MustSucceed targets all have to store the record.
+	MustSucceed Policy = iota
+
+	// Quorum targets have to store the record on at least MultiStorer.Quorum of them, a majority
+	// of them when MultiStorer.Quorum is 0.
+	Quorum
+
+	// BestEffort targets can fail without failing the store.
+	BestEffort
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	switch p {
+	case MustSucceed:
+		return "must-succeed"
+	case Quorum:
+		return "quorum"
+	case BestEffort:
+		return "best-effort"
+	}
+
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// Target is one destination of a MultiStorer.
+type Target struct {
+	Name   string
+	Storer Storer
+	Policy Policy
+}
+
+// Outcome is the result of storing a record into one target.
+type Outcome struct {
+	Target string
+	Policy Policy
+	Err    error
+}
+
+// FanoutError is returned by MultiStorer when at least one target failed or the record does not
+// count as stored.
+type FanoutError struct {
+	Outcomes []Outcome
+	stored   bool
+	quorum   int // Quorum targets that stored the record
+	need     int // Quorum targets that had to
+}
+
+// Error implements the error interface. It lists every target that failed and a quorum that was
+// not reached.
+func (fe *FanoutError) Error() string {
+	var failed []string
+	for _, o := range fe.Outcomes {
+		if o.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%s): %v", o.Target, o.Policy, o.Err))
+		}
+	}
+
+	if fe.quorum < fe.need {
+		failed = append(failed, fmt.Sprintf("quorum not reached: %d of %d", fe.quorum, fe.need))
+	}
+
+	state := "not stored"
+	if fe.stored {
+		state = "stored"
+	}
+
+	return fmt.Sprintf("fanout %s: %s", state, strings.Join(failed, "; "))
+}
+
+// Stored reports whether the record still counts as stored according to the policies.
+func (fe *FanoutError) Stored() bool {
+	return fe.stored
+}
+
+// MultiStorer stores every record into all of its targets concurrently.
+type MultiStorer struct {
+	Targets []Target
+	Quorum  int // Quorum targets that have to succeed, a majority of them when 0
+}
+
+// Store knows how to store data into every target and apply their policies.
+func (ms *MultiStorer) Store(d *Data) error {
+	outcomes := make([]Outcome, len(ms.Targets))
+
+	// Every Goroutine writes to its own element of outcomes, so there is nothing to lock. Every
+	// target gets its own copy of the record too. A Storer is allowed to write to the record it is
+	// given, and one doing it would race with the others reading theirs.
+	var wg sync.WaitGroup
+	wg.Add(len(ms.Targets))
+
+	for i, t := range ms.Targets {
+		go func(i int, t Target, d Data) {
+			defer wg.Done()
+
+			outcomes[i] = Outcome{
+				Target: t.Name,
+				Policy: t.Policy,
+				Err:    t.Storer.Store(&d),
+			}
+		}(i, t, *d)
+	}
+
+	wg.Wait()
+
+	var failed, quorum, targets int
+	stored := true
+
+	for _, o := range outcomes {
+		if o.Err != nil {
+			failed++
+		}
+
+		switch o.Policy {
+		case MustSucceed:
+			if o.Err != nil {
+				stored = false
+			}
+
+		case Quorum:
+			targets++
+			if o.Err == nil {
+				quorum++
+			}
+		}
+	}
+
+	need := ms.Quorum
+	if need == 0 && targets > 0 {
+		need = targets/2 + 1
+	}
+
+	// A Quorum bigger than the number of Quorum targets can't be reached, even when no target
+	// failed.
+	if quorum < need {
+		stored = false
+	}
+
+	if failed == 0 && stored {
+		return nil
+	}
+
+	return &FanoutError{
+		Outcomes: outcomes,
+		stored:   stored,
+		quorum:   quorum,
+		need:     need,
+	}
+}
+
+// stored is declared to test for the existence of the Stored method.
+type stored interface {
+	Stored() bool
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+// An error that says the record still counts as stored is logged and the batch keeps going.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			if e, ok := err.(stored); ok && e.Stored() {
+				fmt.Println("Degraded:", err)
+				continue
+			}
+
+			return i, err
+		}
+
+		fmt.Println("Out:", data[i].Line)
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	ms := MultiStorer{
+		Targets: []Target{
+			{"primary", &Pillar{Host: "primary:9000", Timeout: time.Second, FailRate: 0}, MustSucceed},
+			{"audit-1", &Pillar{Host: "audit-1:9000", Timeout: time.Second, FailRate: 2}, Quorum},
+			{"audit-2", &Pillar{Host: "audit-2:9000", Timeout: time.Second, FailRate: 2}, Quorum},
+			{"audit-3", &Pillar{Host: "audit-3:9000", Timeout: time.Second, FailRate: 2}, Quorum},
+			{"cache", &Pillar{Host: "cache:9000", Timeout: time.Second, FailRate: 5}, BestEffort},
+		},
+		Quorum: 2,
+	}
+
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &ms,
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+}
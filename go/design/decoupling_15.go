@@ -0,0 +1,393 @@
+// ----------------------------
+// Fan In From Multiple Pullers
+// ----------------------------
+
+// This is the mirror image of decoupling_14.go. We now have many Xenia like sources and one
+// Pillar. System holds one Puller, so today we run Copy once per source, one after the other.
+
+// MergePuller is a new concrete type that implements Puller. It holds a list of sources and runs
+// one Goroutine per source, each pulling into its own small queue. Pull then picks the next
+// record out of those queues according to a strategy:
+// - RoundRobin: take turns between the sources that have data ready, so a busy source can't
+//   starve the others.
+// - Priority: always take from the highest priority source that has data ready.
+// - TimeOrdered: take the oldest record across all sources. Each source must already be in time
+//   order. To know which record is the oldest, we need to see the next record of every source
+//   that is still running, so this one waits on the slowest source.
+
+// Every record is tagged with the name of the source it came from, and MergePuller only returns
+// io.EOF once every single source has returned io.EOF. A source that fails is reported by the next
+// Pull and the others keep going, but once they are done Pull returns that failure again instead of
+// io.EOF. The data did not all make it, and the caller must not think it did.
+
+// The Goroutines pulling from the sources only stop on their own when their source is done. A
+// caller that stops before that, because Copy failed for example, calls Close so they don't leak.
+
+// All the Goroutines share the queues, so we protect them with a mutex. Instead of channels, we
+// use a sync.Cond on that mutex to sleep until something changes: a source adding a record, a
+// source finishing, or Pull making room in a queue. With channels, the strategies would need to
+// select over a different set of channels on every call.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Source string
+	Time   time.Time
+	Line   string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+// Every record is Step apart from the previous one, starting at Start.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	Records int
+	Start   time.Time
+	Step    time.Duration
+
+	pos int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if x.pos >= x.Records {
+		return io.EOF
+	}
+
+	d.Line = fmt.Sprintf("%s #%d", x.Host, x.pos)
+	d.Time = x.Start.Add(time.Duration(x.pos) * x.Step)
+	x.pos++
+
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Printf("Out: %-8s %s %s\n", d.Source, d.Time.Format("15:04:05"), d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Strategy decides which source the next record comes from.
+type Strategy int
+
+// Set of merge strategies.
+const (
+	RoundRobin Strategy = iota
+	Priority
+	TimeOrdered
+)
+
+// Source is one of the Pullers a MergePuller reads from.
+// A higher Priority wins under the Priority strategy.
+type Source struct {
+	Name     string
+	Puller   Puller
+	Priority int
+}
+
+// source is the state MergePuller keeps for every Source.
+type source struct {
+	Source
+	queue    []Data
+	done     bool
+	err      error
+	reported bool // err was returned by Pull already
+}
+
+// ErrClosed is returned when pulling from a MergePuller that was closed.
+var ErrClosed = errors.New("merge puller is closed")
+
+// MergePuller pulls from many sources concurrently. It is safe for concurrent use.
+type MergePuller struct {
+	Sources  []Source
+	Strategy Strategy
+	Queue    int // records buffered per source, defaults to 1
+
+	once    sync.Once
+	mu      sync.Mutex
+	cond    *sync.Cond
+	sources []*source
+	next    int
+	closed  bool
+}
+
+// start launches one Goroutine per source, unless Close was called first.
+func (mp *MergePuller) start() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.cond = sync.NewCond(&mp.mu)
+	if mp.Queue < 1 {
+		mp.Queue = 1
+	}
+
+	if mp.closed {
+		return
+	}
+
+	for _, s := range mp.Sources {
+		src := source{Source: s}
+		mp.sources = append(mp.sources, &src)
+
+		go mp.run(&src)
+	}
+}
+
+// run pulls from one source until it is done or Close is called, waiting whenever its queue is
+// full.
+func (mp *MergePuller) run(src *source) {
+	for {
+		var d Data
+		err := src.Puller.Pull(&d)
+
+		mp.mu.Lock()
+
+		if mp.closed {
+			mp.mu.Unlock()
+			return
+		}
+
+		if err != nil {
+			src.done = true
+			if err != io.EOF {
+				src.err = err
+			}
+			mp.cond.Broadcast()
+			mp.mu.Unlock()
+			return
+		}
+
+		d.Source = src.Name
+		src.queue = append(src.queue, d)
+		mp.cond.Broadcast()
+
+		for len(src.queue) >= mp.Queue && !mp.closed {
+			mp.cond.Wait()
+		}
+
+		closed := mp.closed
+		mp.mu.Unlock()
+
+		if closed {
+			return
+		}
+	}
+}
+
+// Pull knows how to pull the next record out of all the sources.
+func (mp *MergePuller) Pull(d *Data) error {
+	mp.once.Do(mp.start)
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for {
+		if mp.closed {
+			return ErrClosed
+		}
+
+		// A failed source is reported as soon as we see it. Then it is treated like any other
+		// finished source, until the end.
+		for _, src := range mp.sources {
+			if src.err != nil && !src.reported {
+				src.reported = true
+				return fmt.Errorf("source %s: %w", src.Name, src.err)
+			}
+		}
+
+		src, ok := mp.pick()
+		if src != nil {
+			*d = src.queue[0]
+			src.queue = src.queue[1:]
+			mp.cond.Broadcast()
+			return nil
+		}
+
+		// Nothing to pick and nothing left to wait for. It is only the end of the data if no
+		// source failed.
+		if ok {
+			for _, src := range mp.sources {
+				if src.err != nil {
+					return fmt.Errorf("source %s: %w", src.Name, src.err)
+				}
+			}
+			return io.EOF
+		}
+
+		mp.cond.Wait()
+	}
+}
+
+// Close stops the Goroutines pulling from the sources and wakes up any Pull waiting for a record.
+// A Goroutine in the middle of pulling from its source stops as soon as that call returns, and its
+// record is dropped. Pull returns ErrClosed from then on.
+func (mp *MergePuller) Close() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.closed = true
+	if mp.cond != nil {
+		mp.cond.Broadcast()
+	}
+
+	return nil
+}
+
+// pick returns the source to take the next record from. When it returns nil, the bool reports
+// whether every source is finished and empty. Otherwise, the caller has to wait.
+// The caller must hold the lock.
+func (mp *MergePuller) pick() (*source, bool) {
+	finished := true
+	for _, src := range mp.sources {
+		if !src.done || len(src.queue) > 0 {
+			finished = false
+			break
+		}
+	}
+
+	if finished {
+		return nil, true
+	}
+
+	switch mp.Strategy {
+	case Priority:
+		var best *source
+		for _, src := range mp.sources {
+			if len(src.queue) > 0 && (best == nil || src.Priority > best.Priority) {
+				best = src
+			}
+		}
+		return best, false
+
+	case TimeOrdered:
+		var oldest *source
+		for _, src := range mp.sources {
+			if len(src.queue) == 0 {
+				// A running source might still produce an older record.
+				if !src.done {
+					return nil, false
+				}
+				continue
+			}
+
+			if oldest == nil || src.queue[0].Time.Before(oldest.queue[0].Time) {
+				oldest = src
+			}
+		}
+		return oldest, false
+
+	default:
+		n := len(mp.sources)
+		for i := 0; i < n; i++ {
+			src := mp.sources[(mp.next+i)%n]
+			if len(src.queue) > 0 {
+				mp.next = (mp.next + i + 1) % n
+				return src, false
+			}
+		}
+		return nil, false
+	}
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mp := MergePuller{
+		Sources: []Source{
+			{"east", &Xenia{Host: "east:8000", Timeout: time.Second, Records: 4, Start: start, Step: 2 * time.Second}, 1},
+			{"west", &Xenia{Host: "west:8000", Timeout: time.Second, Records: 3, Start: start.Add(time.Second), Step: 3 * time.Second}, 2},
+			{"north", &Xenia{Host: "north:8000", Timeout: time.Second, Records: 2, Start: start, Step: 5 * time.Second}, 0},
+		},
+		Strategy: TimeOrdered,
+	}
+	defer mp.Close()
+
+	sys := System{
+		Puller: &mp,
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,415 @@
+// -----------------------
+// Concurrent Copy Engine
+// -----------------------
+
+// Our decoupled system from decoupling_4.go is in production and it works. The next problem is
+// that Copy pulls a batch, stores it, pulls the next one and so on, all on a single Goroutine.
+// While we are waiting on Pillar, nobody is talking to Xenia and the other way around. When we are
+// moving millions of records a day that loop becomes the bottleneck.
+
+// Notice that we don't have to change a single interface to fix this. Puller, Storer and
+// PullStorer stay exactly the same, so every Xenia or Pillar we wrote still works. The only thing
+// that changes is the Copy function, which is now an engine that runs:
+// - N Goroutines pulling batches out of the Puller.
+// - M Goroutines storing batches into the Storer.
+// - A bounded (buffered) channel connecting them. When the storers fall behind, the channel fills
+//   up and the pullers block on the send. We never buffer more than Queue batches in memory.
+
+//                 pullers                    queue                  storers
+//              -------------                                    -------------
+//             |  pull(ps)   |------|                    |----->|  store(ps)  |
+//              -------------       |     -----------    |       -------------
+//              -------------       |--> | | | | | | |---|       -------------
+//             |  pull(ps)   |------|     -----------    |----->|  store(ps)  |
+//              -------------                                    -------------
+
+// Because more than one Goroutine now calls Pull and Store on the same value, the concrete types
+// stored inside the PullStorer must be safe for concurrent use. That is a new contract and it has
+// to be documented on the API.
+
+// Ordering:
+// ---------
+// Every batch gets a sequence number when a puller starts pulling it. With many storers, the
+// batches are stored in whatever order the Goroutines get scheduled. When the caller asks for
+// ordering, we put a resequencer between the queue and a single storer. It holds on to batches
+// that arrive early and only releases the next batch in sequence. We give up the storer
+// concurrency to get the guarantee.
+//
+// The batch order is not enough on its own. Two pullers calling Pull at the same time get their
+// records interleaved, and batch 1 could hold a record the source gave out before the last one of
+// batch 0. So in ordered mode, taking a sequence number and pulling the batch are one step that
+// only one puller at a time can take. The pullers still overlap with each other on the send and
+// with the storer.
+//
+// One slow pull would let the other pullers race ahead and the resequencer would hold on to
+// everything they pulled in the meantime. So in ordered mode a puller doesn't get a sequence number
+// more than Queue batches ahead of the next one to release, it waits for the resequencer to catch
+// up. That keeps the batches held early under Queue too.
+
+// Failures:
+// ---------
+// The old Copy returned on the first error it saw. Now a store failure only fails that record,
+// the storer goes on with the rest of the batch and the engine keeps going. A pull failure that is
+// not io.EOF stops the pullers because we don't know if the source is still healthy. Besides the
+// pull error, the caller gets a Summary that tells them how many records were pulled, stored and
+// failed, and the first store error.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+// The math/rand top level functions are safe for concurrent use so Xenia is too.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(20) {
+	case 1:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	if rand.Intn(20) == 7 {
+		return errors.New("Error storing data into Pillar")
+	}
+
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Config tells the engine how much concurrency to use.
+type Config struct {
+	Batch   int  // number of records in a batch
+	Pullers int  // number of Goroutines pulling batches
+	Storers int  // number of Goroutines storing batches, ignored when Ordered is set
+	Queue   int  // number of batches that can wait between the pullers and the storers
+	Ordered bool // store batches in the same order they were pulled
+}
+
+// Summary describes the outcome of a Copy run.
+type Summary struct {
+	Pulled int // records pulled out of the Puller
+	Stored int // records stored into the Storer
+	Failed int // records that were pulled but could not be stored
+
+	// StoreErr is the first error the Storer returned. Failed counts every one of them.
+	StoreErr error
+}
+
+// batch is the unit of work moving from the pullers to the storers.
+type batch struct {
+	seq  int
+	data []Data
+}
+
+// engine holds the state that is shared by all the Goroutines of a single Copy run.
+type engine struct {
+	ps  PullStorer
+	cfg Config
+
+	// pullMu makes taking a sequence number and pulling its batch one step in ordered mode.
+	pullMu sync.Mutex
+
+	// mu protects everything below it. cond is signaled when released moves or done is set.
+	mu       sync.Mutex
+	cond     *sync.Cond
+	seq      int
+	released int // next sequence number the resequencer releases, in ordered mode
+	done     bool
+	err      error
+	summary  Summary
+}
+
+// Copy knows how to pull and store data from any System concurrently.
+// The values stored inside ps must be safe for concurrent use. Copy returns once the Puller
+// reports io.EOF or fails and every pulled batch has gone through the Storer. The error is the
+// first pull error that is not io.EOF.
+func Copy(ps PullStorer, cfg Config) (Summary, error) {
+	if cfg.Batch < 1 {
+		cfg.Batch = 1
+	}
+	if cfg.Pullers < 1 {
+		cfg.Pullers = 1
+	}
+	if cfg.Storers < 1 || cfg.Ordered {
+		cfg.Storers = 1
+	}
+	if cfg.Queue < 0 {
+		cfg.Queue = 0
+	}
+
+	e := engine{
+		ps:  ps,
+		cfg: cfg,
+	}
+	e.cond = sync.NewCond(&e.mu)
+
+	// This is the bounded channel between the two stages.
+	queue := make(chan batch, cfg.Queue)
+
+	// Fan out the pullers. The last one out closes the queue so the storers know there is
+	// nothing more coming.
+	var pullers sync.WaitGroup
+	pullers.Add(cfg.Pullers)
+	for i := 0; i < cfg.Pullers; i++ {
+		go func() {
+			defer pullers.Done()
+			e.puller(queue)
+		}()
+	}
+
+	go func() {
+		pullers.Wait()
+		close(queue)
+	}()
+
+	// When the caller wants ordering, the storer receives from the resequencer instead.
+	var in <-chan batch = queue
+	if cfg.Ordered {
+		in = e.resequence(queue)
+	}
+
+	var storers sync.WaitGroup
+	storers.Add(cfg.Storers)
+	for i := 0; i < cfg.Storers; i++ {
+		go func() {
+			defer storers.Done()
+			e.storer(in)
+		}()
+	}
+
+	storers.Wait()
+
+	return e.summary, e.err
+}
+
+// next hands out the sequence number for the next batch. It returns false once any puller has
+// seen the end of the data or a failure. In ordered mode it waits while the sequence number would
+// be too far ahead of the resequencer.
+func (e *engine) next() (int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for e.cfg.Ordered && !e.done && e.seq >= e.released+e.window() {
+		e.cond.Wait()
+	}
+
+	if e.done {
+		return 0, false
+	}
+
+	seq := e.seq
+	e.seq++
+
+	return seq, true
+}
+
+// puller pulls batches until the data runs out and sends them down the queue.
+func (e *engine) puller(queue chan<- batch) {
+	for {
+		if e.cfg.Ordered {
+			e.pullMu.Lock()
+		}
+
+		seq, ok := e.next()
+		if !ok {
+			if e.cfg.Ordered {
+				e.pullMu.Unlock()
+			}
+			return
+		}
+
+		// Every batch gets its own slice because it is shared with a storer after the send.
+		data := make([]Data, e.cfg.Batch)
+		i, err := pull(e.ps, data)
+
+		if e.cfg.Ordered {
+			e.pullMu.Unlock()
+		}
+
+		e.mu.Lock()
+		e.summary.Pulled += i
+		if err != nil {
+			e.done = true
+			e.cond.Broadcast()
+			if err != io.EOF && e.err == nil {
+				e.err = err
+			}
+		}
+		e.mu.Unlock()
+
+		// We still send an empty batch. In ordered mode the resequencer is waiting on this
+		// sequence number and would hold every batch after it forever.
+		queue <- batch{seq: seq, data: data[:i]}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// storer stores every record of every batch it receives and keeps count of what made it. A
+// record that fails doesn't stop the ones after it.
+func (e *engine) storer(in <-chan batch) {
+	for b := range in {
+		for i := range b.data {
+			err := e.ps.Store(&b.data[i])
+
+			e.mu.Lock()
+			if err == nil {
+				e.summary.Stored++
+			} else {
+				e.summary.Failed++
+				if e.summary.StoreErr == nil {
+					e.summary.StoreErr = err
+				}
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// window returns how far ahead of the resequencer a sequence number can be handed out.
+func (e *engine) window() int {
+	if e.cfg.Queue < 1 {
+		return 1
+	}
+
+	return e.cfg.Queue
+}
+
+// resequence releases batches in sequence order. Batches that arrive early are held in a map
+// until every batch before them has been released. next keeps the map under Queue batches.
+func (e *engine) resequence(in <-chan batch) <-chan batch {
+	out := make(chan batch)
+
+	go func() {
+		defer close(out)
+
+		next := 0
+		pending := make(map[int]batch)
+
+		for b := range in {
+			pending[b.seq] = b
+
+			for {
+				b, ok := pending[next]
+				if !ok {
+					break
+				}
+
+				delete(pending, next)
+				out <- b
+				next++
+
+				// Let the pullers waiting on us have the next sequence numbers.
+				e.mu.Lock()
+				e.released = next
+				e.cond.Broadcast()
+				e.mu.Unlock()
+			}
+		}
+	}()
+
+	return out
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	cfg := Config{
+		Batch:   3,
+		Pullers: 4,
+		Storers: 2,
+		Queue:   8,
+		Ordered: false,
+	}
+
+	sum, err := Copy(&sys, cfg)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Printf("Pulled: %d Stored: %d Failed: %d\n", sum.Pulled, sum.Stored, sum.Failed)
+	if sum.StoreErr != nil {
+		fmt.Println("First store error:", sum.StoreErr)
+	}
+}
@@ -0,0 +1,378 @@
+// -------------------------------
+// Retry, Backoff and Dead Letters
+// -------------------------------
+
+// Xenia goes over the network and networks are flaky. Right now, one bad read returns an error
+// out of pull, Copy sees something that is not io.EOF and the whole run is over. Same thing on the
+// Pillar side.
+
+// We don't want to teach Xenia or Pillar how to retry. That is a policy and policies change.
+// Instead, we write two new concrete types, RetryPuller and RetryStorer, that wrap any Puller or
+// Storer and implement the very same interface. Copy has no idea it is talking to a wrapper. This
+// is the same decoupling we built in decoupling_4.go used one more time.
+
+// Which errors are worth retrying? We are not going to compare strings or switch on concrete
+// types. We use behavior as context from error_4.go: if the concrete error value stored inside the
+// interface, or any error it wraps, has a Temporary method that says true, we try again. Anything
+// else is permanent.
+
+// How long do we wait between attempts? If all our Goroutines retry at exactly the same time, we
+// hammer a system that is already in trouble. We use exponential backoff with full jitter: the
+// delay doubles on every attempt up to a cap, and we sleep a random amount between 0 and that
+// delay. No cap means the delay keeps doubling.
+
+// What happens when we run out of attempts?
+// - For a pull, there is no record yet so the error goes back to Copy.
+// - For a store, we have the record in hand. Instead of failing the run, we hand it to a dead
+//   letter Storer, and report success to Copy. Somebody can look at those records later and
+//   replay them. The dead letter is just another Storer. If it also knows how to Bury, it gets
+//   the reason too, behavior as context one more time.
+// - A store can also fail with a permanent error on the first attempt. That record goes to the dead
+//   letter as well, since retrying later is still all we can do with it. To tell the two apart,
+//   the reason for a record we gave up retrying is an ExhaustedError.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// netError is the custom error type Xenia and Pillar return when the network misbehaves.
+type netError struct {
+	op   string
+	temp bool
+}
+
+// Error implements the error interface.
+func (e *netError) Error() string {
+	return fmt.Sprintf("network error during %s, temporary: %v", e.op, e.temp)
+}
+
+// Temporary reports whether trying again could succeed.
+func (e *netError) Temporary() bool {
+	return e.temp
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(20) {
+	case 1:
+		return io.EOF
+
+	case 5, 6, 7:
+		return &netError{op: "read", temp: true}
+
+	case 9:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	if rand.Intn(3) == 0 {
+		return &netError{op: "write", temp: true}
+	}
+
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// temporary is declared to test for the existence of the Temporary method, just like we did in
+// error_4.go.
+type temporary interface {
+	Temporary() bool
+}
+
+// retryable classifies an error. Only temporary errors are worth another attempt and io.EOF is
+// never an error we retry, it is a signal. errors.As finds the behavior even when the error was
+// wrapped on its way to us.
+func retryable(err error) bool {
+	if errors.Is(err, io.EOF) {
+		return false
+	}
+
+	var t temporary
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+
+	return false
+}
+
+// Policy describes how many times and how far apart we retry.
+type Policy struct {
+	MaxAttempts int           // total attempts including the first one
+	BaseDelay   time.Duration // delay before the second attempt
+	MaxDelay    time.Duration // cap on the delay between any two attempts, no cap when 0
+}
+
+// backoff returns how long to sleep after the given failed attempt, counting from 1.
+// The ceiling doubles on every attempt and we pick a random delay below it (full jitter).
+func (p Policy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || ceiling < p.MaxDelay); i++ {
+		ceiling *= 2
+	}
+
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// do runs fn until it succeeds, fails with an error that is not retryable or runs out of
+// attempts. It returns the last error.
+func (p Policy) do(fn func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !retryable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		time.Sleep(p.backoff(attempt))
+	}
+}
+
+// RetryPuller wraps any Puller with a retry policy.
+type RetryPuller struct {
+	Puller
+	Policy Policy
+}
+
+// Pull knows how to pull data out of the wrapped Puller, trying again on temporary errors.
+func (r *RetryPuller) Pull(d *Data) error {
+	return r.Policy.do(func() error {
+		return r.Puller.Pull(d)
+	})
+}
+
+// ExhaustedError is the reason given to the dead letter for a record that still failed with a
+// temporary error once the policy ran out of attempts. Any other reason is a permanent error.
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+// Error implements the error interface.
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// burier is declared to test for the existence of the Bury method, a Storer that can keep the
+// reason together with the record.
+type burier interface {
+	Bury(d *Data, err error) error
+}
+
+// RetryStorer wraps any Storer with a retry policy. Records that still fail once the policy
+// gives up are sent to DeadLetter instead of failing the caller.
+type RetryStorer struct {
+	Storer
+	Policy     Policy
+	DeadLetter Storer
+}
+
+// Store knows how to store data into the wrapped Storer, trying again on temporary errors.
+func (r *RetryStorer) Store(d *Data) error {
+	err := r.Policy.do(func() error {
+		return r.Storer.Store(d)
+	})
+
+	if err == nil || r.DeadLetter == nil {
+		return err
+	}
+
+	// A temporary error at this point means the policy ran out of attempts.
+	if retryable(err) {
+		attempts := r.Policy.MaxAttempts
+		if attempts < 1 {
+			attempts = 1
+		}
+		err = &ExhaustedError{Attempts: attempts, Err: err}
+	}
+
+	if b, ok := r.DeadLetter.(burier); ok {
+		return b.Bury(d, err)
+	}
+
+	return r.DeadLetter.Store(d)
+}
+
+// Letter is a record that could not be stored and the reason why.
+type Letter struct {
+	Data Data
+	Err  error
+}
+
+// DeadLetter is a Storer that keeps every record handed to it so it can be looked at and
+// replayed later. It is safe for concurrent use.
+type DeadLetter struct {
+	mu      sync.Mutex
+	letters []Letter
+}
+
+// Store knows how to store data into the dead letter queue.
+func (dl *DeadLetter) Store(d *Data) error {
+	return dl.Bury(d, nil)
+}
+
+// Bury keeps a copy of the record together with the error that sent it here.
+func (dl *DeadLetter) Bury(d *Data, err error) error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	dl.letters = append(dl.letters, Letter{Data: *d, Err: err})
+	return nil
+}
+
+// Letters returns a copy of everything in the dead letter queue.
+func (dl *DeadLetter) Letters() []Letter {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	letters := make([]Letter, len(dl.letters))
+	copy(letters, dl.letters)
+
+	return letters
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	policy := Policy{
+		MaxAttempts: 3,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    100 * time.Millisecond,
+	}
+
+	var dl DeadLetter
+
+	// We decide at startup which systems get a retry policy. Xenia and Pillar never change.
+	sys := System{
+		Puller: &RetryPuller{
+			Puller: &Xenia{
+				Host:    "localhost:8000",
+				Timeout: time.Second,
+			},
+			Policy: policy,
+		},
+		Storer: &RetryStorer{
+			Storer: &Pillar{
+				Host:    "localhost:9000",
+				Timeout: time.Second,
+			},
+			Policy:     policy,
+			DeadLetter: &dl,
+		},
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	for _, l := range dl.Letters() {
+		fmt.Printf("Dead Letter: %s: %v\n", l.Data.Line, l.Err)
+	}
+}
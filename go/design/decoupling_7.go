@@ -0,0 +1,313 @@
+// ------------------------------
+// Checkpoints and Resumable Copy
+// ------------------------------
+
+// Our nightly sync job calls Copy. When it fails halfway, we have no idea how far it got, so the
+// rerun starts from the beginning and everything that was already stored in Pillar gets stored a
+// second time.
+
+// We need 2 new pieces of behavior:
+// - Somewhere to remember how far we got. That is a Checkpointer. Copy saves the offset after
+//   every batch that made it into the Storer. The offset is the number of records stored so far.
+// - A way to start pulling from that offset. That is a Seeker, the method of io.Seeker with the
+//   offset counted in records. Not every Puller can seek, so we are not going to add Seek to the
+//   Puller interface and break every Puller we have. Resume asks the concrete value stored inside
+//   the PullStorer if it also implements Seeker, just like we asked about Temporary in
+//   error_4.go. System implements it by asking its Puller in turn, so Resume never needs to know
+//   what concrete type it was given. A run starting at offset 0 has nothing to seek to and works
+//   with any Puller.
+
+// Why "exactly-once-ish"? We save the checkpoint after the store. If the process dies in between,
+// the rerun stores that one batch again. The window is one batch instead of the whole run. To get
+// all the way to exactly once, the Storer has to accept duplicates, for example by using the
+// offset as a key.
+
+// FileCheckpoint writes the offset to a temp file first and then renames it over the real one.
+// A rename is atomic, so a crash in the middle of a save leaves us with the old checkpoint and
+// never with half a file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Seeker declares behavior for moving to a record offset. It has the method of io.Seeker, where
+// the offset is counted in records instead of bytes.
+type Seeker interface {
+	Seek(offset int64, whence int) (int64, error)
+}
+
+// Checkpointer declares behavior for remembering how far a copy got.
+type Checkpointer interface {
+	Load() (int64, error)
+	Save(offset int64) error
+}
+
+// Xenia is a system we need to pull data from.
+// It holds a fixed number of records so we can tell which ones were copied.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	Records int64
+
+	pos int64
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if x.pos >= x.Records {
+		return io.EOF
+	}
+
+	d.Line = fmt.Sprintf("Data %d", x.pos)
+	x.pos++
+
+	fmt.Println("In:", d.Line)
+	return nil
+}
+
+// Seek knows how to move Xenia to a record offset.
+func (x *Xenia) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += x.pos
+	case io.SeekEnd:
+		offset += x.Records
+	}
+
+	if offset < 0 || offset > x.Records {
+		return x.pos, fmt.Errorf("seek offset %d out of range [0, %d]", offset, x.Records)
+	}
+
+	x.pos = offset
+	return x.pos, nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	if rand.Intn(10) == 5 {
+		return errors.New("Error storing data into Pillar")
+	}
+
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// errNoSeek is returned when seeking a Puller that does not support it.
+var errNoSeek = errors.New("puller does not support seeking, cannot resume")
+
+// Seek knows how to move the Puller of the System to a record offset, if the Puller is a Seeker.
+func (s *System) Seek(offset int64, whence int) (int64, error) {
+	sk, ok := s.Puller.(Seeker)
+	if !ok {
+		return 0, errNoSeek
+	}
+
+	return sk.Seek(offset, whence)
+}
+
+// FileCheckpoint is a Checkpointer backed by a file on disk.
+type FileCheckpoint struct {
+	Path string
+}
+
+// Load knows how to read the last saved offset. A missing file means we never saved one.
+func (fc *FileCheckpoint) Load() (int64, error) {
+	b, err := ioutil.ReadFile(fc.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// Save knows how to write the offset so that a crash never leaves a partial file behind.
+func (fc *FileCheckpoint) Save(offset int64) error {
+	f, err := ioutil.TempFile(filepath.Dir(fc.Path), filepath.Base(fc.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(strconv.FormatInt(offset, 10) + "\n"); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	// Make sure the bytes are on disk before the rename makes them visible.
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), fc.Path)
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System, starting at offset and saving a
+// checkpoint after every stored batch.
+func Copy(ps PullStorer, batch int, cp Checkpointer, offset int64) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			n, serr := store(ps, data[:i])
+
+			// Even a partial store moves the offset forward. Those records are in the Storer.
+			offset += int64(n)
+			if cerr := cp.Save(offset); cerr != nil {
+				return cerr
+			}
+
+			if serr != nil {
+				return serr
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Resume knows how to continue a Copy from the last checkpoint. Past offset 0, the value stored
+// inside ps must also be a Seeker.
+func Resume(ps PullStorer, batch int, cp Checkpointer) error {
+	offset, err := cp.Load()
+	if err != nil {
+		return err
+	}
+
+	// Does the concrete value stored inside the PullStorer also know how to seek? There is no need
+	// to ask when we start from the beginning.
+	if offset > 0 {
+		s, ok := ps.(Seeker)
+		if !ok {
+			return errNoSeek
+		}
+
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	return Copy(ps, batch, cp, offset)
+}
+
+func main() {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+			Records: 20,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	cp := FileCheckpoint{
+		Path: filepath.Join(dir, "xenia-pillar"),
+	}
+
+	// Keep resuming until Xenia runs out of data. Every rerun picks up where the last one died.
+	for run := 1; ; run++ {
+		fmt.Println("Run:", run)
+
+		err := Resume(&sys, 3, &cp)
+		if err == io.EOF {
+			break
+		}
+
+		fmt.Println(err)
+	}
+
+	offset, _ := cp.Load()
+	fmt.Println("Checkpoint:", offset)
+}
@@ -0,0 +1,259 @@
+// --------------------
+// Transformation Stage
+// --------------------
+
+// Every time someone needs to enrich Data.Line before it lands in Pillar, they hack it into a
+// Puller. Now Xenia knows about Pillar's business rules and we are back to concrete coupling.
+
+// There is a third behavior hiding in between pull and store: transform. We declare it with an
+// interface and Copy accepts an ordered list of them. Each Transformer takes one record and
+// returns zero, one or many records. That one signature covers everything we need:
+// - filter: return the record or nothing.
+// - map: return one changed record.
+// - split: return many records.
+// - drop: return nothing.
+
+//    Puller                 Transformers                  Storer
+//   --------     ---------     ---------     ---------     --------
+//  |  pull  |-->| filter  |-->|   map   |-->|  split  |-->| store  |
+//   --------     ---------     ---------     ---------     --------
+
+// Most transformations are a single function. Writing a new concrete type for every one of them is
+// noise, so we use the same trick as http.HandlerFunc: a function type that has a method. Any
+// function with the right signature can be converted into a TransformFunc and is a Transformer.
+// Filter, Map and Split are small helpers that build one for the common cases.
+
+// Now the pipeline is composed at startup in main. Xenia and Pillar don't change.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Transformer declares behavior for changing data between pulling and storing.
+// Returning no records drops the record, returning many splits it.
+type Transformer interface {
+	Transform(d Data) ([]Data, error)
+}
+
+// TransformFunc is an adapter to allow the use of ordinary functions as Transformers.
+type TransformFunc func(d Data) ([]Data, error)
+
+// Transform calls f(d).
+func (f TransformFunc) Transform(d Data) ([]Data, error) {
+	return f(d)
+}
+
+// Filter returns a Transformer that only keeps the records keep returns true for.
+func Filter(keep func(d Data) bool) Transformer {
+	return TransformFunc(func(d Data) ([]Data, error) {
+		if !keep(d) {
+			return nil, nil
+		}
+		return []Data{d}, nil
+	})
+}
+
+// Map returns a Transformer that replaces every record with the result of fn.
+func Map(fn func(d Data) Data) Transformer {
+	return TransformFunc(func(d Data) ([]Data, error) {
+		return []Data{fn(d)}, nil
+	})
+}
+
+// Split returns a Transformer that replaces every record with the records fn returns.
+func Split(fn func(d Data) []Data) Transformer {
+	return TransformFunc(func(d Data) ([]Data, error) {
+		return fn(d), nil
+	})
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// lines is what Xenia has to offer.
+var lines = []string{
+	"bill,ed",
+	"",
+	"jack",
+	"jill,mary,ed",
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = lines[rand.Intn(len(lines))]
+		fmt.Printf("In: %q\n", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Printf("Out: %q\n", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// transform knows how to run bulks of data through a chain of Transformers in order. The output
+// of one Transformer is the input of the next.
+func transform(ts []Transformer, data []Data) ([]Data, error) {
+	for _, t := range ts {
+		var out []Data
+
+		for _, d := range data {
+			res, err := t.Transform(d)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, res...)
+		}
+
+		data = out
+	}
+
+	return data, nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull, transform and store data from any System.
+func Copy(ps PullStorer, batch int, ts ...Transformer) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			out, err := transform(ts, data[:i])
+			if err != nil {
+				return err
+			}
+
+			if _, err := store(ps, out); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	// The ETL pipeline is composed here, at startup.
+	pipeline := []Transformer{
+		// Drop empty lines.
+		Filter(func(d Data) bool {
+			return d.Line != ""
+		}),
+
+		// One line can carry many names.
+		Split(func(d Data) []Data {
+			var out []Data
+			for _, name := range strings.Split(d.Line, ",") {
+				out = append(out, Data{Line: name})
+			}
+			return out
+		}),
+
+		// We never copy ed.
+		Filter(func(d Data) bool {
+			return d.Line != "ed"
+		}),
+
+		// Pillar wants upper case.
+		Map(func(d Data) Data {
+			d.Line = strings.ToUpper(d.Line)
+			return d
+		}),
+	}
+
+	if err := Copy(&sys, 3, pipeline...); err != io.EOF {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,362 @@
+// -----------------
+// Concrete Adapters
+// -----------------
+
+// Xenia and Pillar have been carrying Host and Timeout around since decoupling_1.go and never
+// used them. They print to stdout and fail at random. It was good enough to learn the mechanics,
+// but now we want to run Copy against real data.
+
+// Because Copy only knows about Puller and Storer, all we have to do is write new concrete types.
+// Nothing else in the program changes.
+// - LinePuller and LineStorer work with line delimited text. They are built on top of io.Reader and
+//   io.Writer so they work with files, sockets, buffers or anything else that can read or write.
+// - JSONPuller and JSONStorer do the same for JSON lines streams, one JSON document per line.
+// - Xenia and Pillar now talk HTTP. Xenia streams JSON lines out of GET http://Host/data and
+//   Pillar sends every record with POST http://Host/data. Both honor Timeout through the
+//   http.Client.
+
+// Look at how the adapters compose. Xenia does not decode JSON itself. Once the response comes
+// back, it stores a JSONPuller built on top of the response body and asks it for the data. Once
+// again we build layers of API on top of each other.
+
+// We also get to stop relying on random failures. Just like in go/testing/web_test.go, main stands
+// up httptest servers that play the role of Xenia and Pillar, so the whole pipeline runs against a
+// real network without leaving the machine.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string `json:"line"`
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// LinePuller pulls one record for every line of text read from an io.Reader.
+type LinePuller struct {
+	scanner *bufio.Scanner
+}
+
+// NewLinePuller returns a LinePuller reading from r.
+func NewLinePuller(r io.Reader) *LinePuller {
+	return &LinePuller{
+		scanner: bufio.NewScanner(r),
+	}
+}
+
+// Pull knows how to pull the next line out of the reader.
+func (lp *LinePuller) Pull(d *Data) error {
+	if !lp.scanner.Scan() {
+		if err := lp.scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	d.Line = lp.scanner.Text()
+	return nil
+}
+
+// LineStorer stores every record as one line of text on an io.Writer.
+type LineStorer struct {
+	w io.Writer
+}
+
+// NewLineStorer returns a LineStorer writing to w.
+func NewLineStorer(w io.Writer) *LineStorer {
+	return &LineStorer{
+		w: w,
+	}
+}
+
+// Store knows how to write a record as a line.
+func (ls *LineStorer) Store(d *Data) error {
+	_, err := io.WriteString(ls.w, d.Line+"\n")
+	return err
+}
+
+// JSONPuller pulls one record for every JSON document read from an io.Reader.
+type JSONPuller struct {
+	dec *json.Decoder
+}
+
+// NewJSONPuller returns a JSONPuller reading from r.
+func NewJSONPuller(r io.Reader) *JSONPuller {
+	return &JSONPuller{
+		dec: json.NewDecoder(r),
+	}
+}
+
+// Pull knows how to decode the next JSON document out of the reader. The decoder returns io.EOF
+// itself when the stream ends between documents.
+func (jp *JSONPuller) Pull(d *Data) error {
+	// Decode leaves the fields missing from the document alone, and Copy reuses d. Without this,
+	// a record with no line would get the line of the record before it.
+	*d = Data{}
+
+	return jp.dec.Decode(d)
+}
+
+// JSONStorer stores every record as one JSON document per line on an io.Writer.
+type JSONStorer struct {
+	enc *json.Encoder
+}
+
+// NewJSONStorer returns a JSONStorer writing to w.
+func NewJSONStorer(w io.Writer) *JSONStorer {
+	return &JSONStorer{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Store knows how to encode a record as a JSON line.
+func (js *JSONStorer) Store(d *Data) error {
+	return js.enc.Encode(d)
+}
+
+// Xenia is a system we need to pull data from. It serves JSON lines over HTTP.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+
+	body io.ReadCloser
+	jp   *JSONPuller
+}
+
+// Pull knows how to pull data out of Xenia. The first call opens the stream.
+// The Timeout covers the whole stream, including reading the body.
+func (x *Xenia) Pull(d *Data) error {
+	if x.jp == nil {
+		client := http.Client{
+			Timeout: x.Timeout,
+		}
+
+		resp, err := client.Get("http://" + x.Host + "/data")
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("xenia: GET /data: %s", resp.Status)
+		}
+
+		x.body = resp.Body
+		x.jp = NewJSONPuller(resp.Body)
+	}
+
+	err := x.jp.Pull(d)
+	if err != nil {
+		x.Close()
+	}
+
+	return err
+}
+
+// Close releases the stream. It is safe to call more than once, and the next Pull opens a new
+// stream.
+func (x *Xenia) Close() error {
+	if x.body == nil {
+		return nil
+	}
+
+	err := x.body.Close()
+	x.body = nil
+	x.jp = nil
+
+	return err
+}
+
+// Pillar is a system we need to store data into. It accepts JSON documents over HTTP.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	client := http.Client{
+		Timeout: p.Timeout,
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSONStorer(&buf).Store(d); err != nil {
+		return err
+	}
+
+	resp, err := client.Post("http://"+p.Host+"/data", "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("pillar: POST /data: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// xeniaServer returns a server that streams the feed as JSON lines.
+func xeniaServer(feed []string) *httptest.Server {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/data" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		js := NewJSONStorer(w)
+		for _, line := range feed {
+			js.Store(&Data{Line: line})
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+// pillarServer returns a server that keeps every record it receives.
+func pillarServer(mu *sync.Mutex, got *[]string) *httptest.Server {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/data" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var d Data
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		*got = append(*got, d.Line)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+func main() {
+	// Copy a line delimited "file" into a JSON lines stream on stdout. A strings.Reader plays the
+	// role of the *os.File, they are both io.Readers.
+	file := strings.NewReader("bill\njill\njack\n")
+
+	sys := System{
+		Puller: NewLinePuller(file),
+		Storer: NewJSONStorer(os.Stdout),
+	}
+
+	if err := Copy(&sys, 2); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	// Copy from Xenia to Pillar over HTTP.
+	xs := xeniaServer([]string{"ed", "mary", "pat", "sam"})
+	defer xs.Close()
+
+	var mu sync.Mutex
+	var got []string
+	ps := pillarServer(&mu, &got)
+	defer ps.Close()
+
+	// The httptest servers give us their URL. Xenia and Pillar want a host.
+	sys = System{
+		Puller: &Xenia{
+			Host:    strings.TrimPrefix(xs.URL, "http://"),
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    strings.TrimPrefix(ps.URL, "http://"),
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	mu.Lock()
+	fmt.Println("Pillar:", got)
+	mu.Unlock()
+}
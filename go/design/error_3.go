@@ -103,3 +103,7 @@ func Unmarshal(data []byte, v interface{}) error {
 
 // This sometime has to happen. Can we do something different not to lose the decoupling. This is
 // where the idea of behavior as context comes in.
+
+// The Unmarshal above only pretends. go/design/unmarshal is a real decoder built on these two
+// types. Its UnmarshalTypeError also carries the path to the value, like .users[3].name, and the
+// byte offset, and UnmarshalAll reports every type error in a document instead of the first one.
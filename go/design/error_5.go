@@ -38,3 +38,11 @@ func main() {
 
 	log.Println("No Error")
 }
+
+// This bug is easy to write and hard to spot in a code review, so we have a tool to find it.
+// go/design/errptr is a vet-style analyzer that reports functions returning a concrete error
+// pointer and every place one of them gets stored inside an error interface.
+// It is a module of its own. Run it on this file with:
+// `go run github.com/hoanhan101/ultimate-go/go/design/errptr/cmd/errptr@latest ./go/design/error_5.go`
+// or install it with go install and use it as a vet tool:
+// `go vet -vettool=$(go env GOPATH)/bin/errptr ./go/design/error_5.go`
@@ -11,17 +11,20 @@
 // are not actionable because we don't necessarily lookup the log for that.
 
 // There is a package that is written by Dave Cheney called errors that let us simplify error
-// handling and logging at the same time. Below is a demonstration on how to leverage the package
-// to simplify our code. By reducing logging, we also reduce a large amount of pressure on the heap
-// (garbage collection).
+// handling and logging at the same time. That package is archived now, so we use our own
+// go/design/errors package instead. It has the same Wrap, Wrapf and Cause functions, and it also
+// plays well with errors.Is and errors.As from the standard library. Below is a demonstration on
+// how to leverage the package to simplify our code. By reducing logging, we also reduce a large
+// amount of pressure on the heap (garbage collection).
 
 package main
 
 import (
 	"fmt"
 
-	// This is Dave Cheney's errors package that have all the wrapping functions.
-	"github.com/pkg/errors"
+	// This is our errors package, modeled after Dave Cheney's, that have all the wrapping
+	// functions.
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
 )
 
 // AppError represents a custom error type.
@@ -0,0 +1,160 @@
+package errors
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Class is a set of behaviors an error has. Classes can be combined with |.
+type Class uint
+
+// Set of behaviors an error can be classified with.
+const (
+	Temporary Class = 1 << iota
+	Timeout
+	NotFound
+	Conflict
+	Retryable
+)
+
+// names is the order and spelling String uses.
+var names = []struct {
+	c    Class
+	name string
+}{
+	{Temporary, "temporary"},
+	{Timeout, "timeout"},
+	{NotFound, "not-found"},
+	{Conflict, "conflict"},
+	{Retryable, "retryable"},
+}
+
+// Has reports whether c has every behavior in other.
+func (c Class) Has(other Class) bool {
+	return c&other == other
+}
+
+// String returns the behaviors separated by |, or "none".
+func (c Class) String() string {
+	var parts []string
+	for _, n := range names {
+		if c.Has(n.c) {
+			parts = append(parts, n.name)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "none"
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// Classifier looks at a single error, not the chain it wraps, and returns the behaviors it
+// recognizes. It returns 0 when it recognizes nothing.
+type Classifier func(err error) Class
+
+// These are the behaviors we ask the concrete error value about, the same way error_4.go asks
+// about Temporary. Any error in any package that has one of these methods is classified without
+// having to register anything.
+type (
+	temporary interface{ Temporary() bool }
+	timeout   interface{ Timeout() bool }
+	notFound  interface{ NotFound() bool }
+	conflict  interface{ Conflict() bool }
+	retryable interface{ Retryable() bool }
+)
+
+// behaviors is the Classifier that is always registered.
+func behaviors(err error) Class {
+	var c Class
+
+	if e, ok := err.(temporary); ok && e.Temporary() {
+		c |= Temporary
+	}
+	if e, ok := err.(timeout); ok && e.Timeout() {
+		c |= Timeout
+	}
+	if e, ok := err.(notFound); ok && e.NotFound() {
+		c |= NotFound
+	}
+	if e, ok := err.(conflict); ok && e.Conflict() {
+		c |= Conflict
+	}
+	if e, ok := err.(retryable); ok && e.Retryable() {
+		c |= Retryable
+	}
+
+	return c
+}
+
+// registry holds every Classifier packages registered.
+var registry = struct {
+	sync.RWMutex
+	classifiers []Classifier
+}{
+	classifiers: []Classifier{behaviors},
+}
+
+// Register adds a Classifier that Classify consults for every error in a chain. Packages usually
+// call it from init for the error types and values they own. It is safe for concurrent use.
+func Register(fn Classifier) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.classifiers = append(registry.classifiers, fn)
+}
+
+// RegisterSentinel classifies an error variable, like ErrBadRequest, with c. It is matched by
+// identity anywhere in the chain. An error of a type that can't be compared, like a slice, is
+// never a match: comparing two of them with == panics.
+func RegisterSentinel(target error, c Class) {
+	Register(func(err error) Class {
+		if err != nil && reflect.TypeOf(err).Comparable() && err == target {
+			return c
+		}
+		return 0
+	})
+}
+
+// Classify walks the whole chain of err, following Unwrap and Cause, and returns every behavior
+// any registered Classifier recognized along the way. An error that is Temporary or a Timeout is
+// also Retryable. Classify(nil) returns 0.
+func Classify(err error) Class {
+	registry.RLock()
+	classifiers := registry.classifiers
+	registry.RUnlock()
+
+	var c Class
+
+	// An error can wrap more than one error, so the chain is really a tree.
+	queue := []error{err}
+	for len(queue) > 0 {
+		err := queue[0]
+		queue = queue[1:]
+
+		if err == nil {
+			continue
+		}
+
+		for _, fn := range classifiers {
+			c |= fn(err)
+		}
+
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			queue = append(queue, e.Unwrap()...)
+		case interface{ Unwrap() error }:
+			queue = append(queue, e.Unwrap())
+		case interface{ Cause() error }:
+			queue = append(queue, e.Cause())
+		}
+	}
+
+	if c&(Temporary|Timeout) != 0 {
+		c |= Retryable
+	}
+
+	return c
+}
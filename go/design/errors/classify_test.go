@@ -0,0 +1,73 @@
+package errors_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// netError has the same Temporary and Timeout behaviors as the errors in the net package.
+type netError struct {
+	temporary bool
+	timeout   bool
+}
+
+func (e *netError) Error() string   { return "net error" }
+func (e *netError) Temporary() bool { return e.temporary }
+func (e *netError) Timeout() bool   { return e.timeout }
+
+// missingError has the NotFound behavior.
+type missingError struct{}
+
+func (missingError) Error() string  { return "missing" }
+func (missingError) NotFound() bool { return true }
+
+// listError is an error type that can't be compared with ==.
+type listError []error
+
+func (listError) Error() string { return "list" }
+
+// errLocked is an error variable that is registered as a Conflict.
+var errLocked = errors.New("locked")
+
+// errBatch is an error variable of a type that can't be compared.
+var errBatch = listError{io.EOF}
+
+func init() {
+	errors.RegisterSentinel(errLocked, errors.Conflict)
+	errors.RegisterSentinel(errBatch, errors.Conflict)
+}
+
+// TestClassify validates that behaviors are found anywhere in the chain.
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errors.Class
+	}{
+		{"nil", nil, 0},
+		{"plain", io.EOF, 0},
+		{"temporary", &netError{temporary: true}, errors.Temporary | errors.Retryable},
+		{"wrapped timeout", errors.Wrap(&netError{timeout: true}, "dial"), errors.Timeout | errors.Retryable},
+		{"std wrapped not found", fmt.Errorf("load user: %w", missingError{}), errors.NotFound},
+		{"registered sentinel", errors.WithCode(errLocked, "LOCKED"), errors.Conflict},
+		{"non-comparable", listError{io.EOF}, 0},
+	}
+
+	t.Log("Given the need to classify errors by behavior.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest: %d\tWhen classifying a %s error.", i, tt.name)
+			{
+				got := errors.Classify(tt.err)
+				if got != tt.want {
+					t.Errorf("\t%s\tShould be classified as %v : %v", failed, tt.want, got)
+					continue
+				}
+				t.Logf("\t%s\tShould be classified as %v.", succeed, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Package errors provides error values that carry context: a stack trace, a code and structured
+// fields, with support for wrapping.
+//
+// It keeps the workflow of github.com/pkg/errors used in error_6.go: wrap on the way up the call
+// stack with Wrap and Wrapf, find the root with Cause and print everything with %+v. It also works
+// with the standard library. Every wrapped error implements Unwrap, so errors.Is and errors.As
+// from the standard library, and Is and As from this package, look through the whole chain.
+//
+// Classify turns behavior as context from error_4.go into a single call. It walks the chain and
+// reports which behaviors, like Temporary or NotFound, any error in it has.
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// Field is one piece of structured context attached to an error.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Error is the concrete type behind every error this package creates.
+// It is exported so callers can use As to get to it, but they should only need the functions.
+type Error struct {
+	msg    string
+	cause  error
+	code   string
+	fields []Field
+	stack  []uintptr
+}
+
+// New returns an error with the message and the stack trace at the point it was called.
+func New(message string) error {
+	return &Error{
+		msg:   message,
+		stack: callers(),
+	}
+}
+
+// Errorf returns an error formatted according to a format specifier, with the stack trace at the
+// point it was called.
+func Errorf(format string, args ...interface{}) error {
+	return &Error{
+		msg:   fmt.Sprintf(format, args...),
+		stack: callers(),
+	}
+}
+
+// Wrap returns an error annotating err with the message and the stack trace at the point Wrap is
+// called. If err is nil, Wrap returns nil.
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		msg:   message,
+		cause: err,
+		stack: callers(),
+	}
+}
+
+// Wrapf returns an error annotating err with a formatted message and the stack trace at the
+// point Wrapf is called. If err is nil, Wrapf returns nil.
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		msg:   fmt.Sprintf(format, args...),
+		cause: err,
+		stack: callers(),
+	}
+}
+
+// WithCode returns an error annotating err with a machine readable code.
+// If err is nil, WithCode returns nil.
+func WithCode(err error, code string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		cause: err,
+		code:  code,
+	}
+}
+
+// WithFields returns an error annotating err with key/value pairs. The keys must be strings;
+// a key without a value gets a nil value. If err is nil, WithFields returns nil.
+func WithFields(err error, keyvals ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	fields := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		f := Field{Key: fmt.Sprint(keyvals[i])}
+		if i+1 < len(keyvals) {
+			f.Value = keyvals[i+1]
+		}
+		fields = append(fields, f)
+	}
+
+	return &Error{
+		cause:  err,
+		fields: fields,
+	}
+}
+
+// Error implements the error interface. It returns the messages of the whole chain separated by
+// colons, the same way pkg/errors does.
+func (e *Error) Error() string {
+	switch {
+	case e.cause == nil:
+		return e.msg
+	case e.msg == "":
+		return e.cause.Error()
+	}
+
+	return e.msg + ": " + e.cause.Error()
+}
+
+// Unwrap returns the error this one wraps, if any. This is what lets errors.Is and errors.As walk
+// the chain.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Cause returns the error this one wraps, if any. It keeps Cause working on chains that mix this
+// package with pkg/errors.
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// Format implements fmt.Formatter.
+//
+//	%s, %v print the message of the whole chain.
+//	%q     prints the same, quoted.
+//	%+v    prints the chain from the root up, every layer with its code, fields and stack trace.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			if e.cause != nil {
+				fmt.Fprintf(s, "%+v", e.cause)
+			}
+
+			var parts []string
+			if e.msg != "" {
+				parts = append(parts, e.msg)
+			}
+			if e.code != "" {
+				parts = append(parts, "code="+e.code)
+			}
+			for _, f := range e.fields {
+				parts = append(parts, fmt.Sprintf("%s=%v", f.Key, f.Value))
+			}
+
+			if len(parts) > 0 {
+				if e.cause != nil {
+					io.WriteString(s, "\n")
+				}
+				io.WriteString(s, strings.Join(parts, " "))
+			}
+
+			e.writeStack(s)
+			return
+		}
+		fallthrough
+
+	case 's':
+		io.WriteString(s, e.Error())
+
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	}
+}
+
+// writeStack writes one function and file:line pair per frame.
+func (e *Error) writeStack(w io.Writer) {
+	if len(e.stack) == 0 {
+		return
+	}
+
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(w, "\n%s\n\t%s:%d", f.Function, f.File, f.Line)
+
+		if !more {
+			return
+		}
+	}
+}
+
+// callers captures the stack of the caller of the function that called it.
+func callers() []uintptr {
+	const depth = 32
+
+	var pcs [depth]uintptr
+	n := runtime.Callers(3, pcs[:])
+
+	return pcs[:n]
+}
+
+// Cause returns the root of the chain: the first error that wraps nothing. Both Unwrap and the
+// pkg/errors Cause method are followed. If err is nil, Cause returns nil.
+func Cause(err error) error {
+	for err != nil {
+		var next error
+
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			next = e.Cause()
+		case interface{ Unwrap() error }:
+			next = e.Unwrap()
+		}
+
+		if next == nil {
+			return err
+		}
+
+		err = next
+	}
+
+	return nil
+}
+
+// Code returns the outermost code in the chain, or an empty string if there is none.
+func Code(err error) string {
+	var e *Error
+	for stderrors.As(err, &e) {
+		if e.code != "" {
+			return e.code
+		}
+		err = e.cause
+	}
+
+	return ""
+}
+
+// Fields returns every field in the chain, outermost first. When the same key is set more than
+// once, the outermost value wins.
+func Fields(err error) []Field {
+	var fields []Field
+	seen := make(map[string]bool)
+
+	var e *Error
+	for stderrors.As(err, &e) {
+		for _, f := range e.fields {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				fields = append(fields, f)
+			}
+		}
+		err = e.cause
+	}
+
+	return fields
+}
+
+// Is reports whether any error in err's chain matches target. It is errors.Is from the standard
+// library, here so callers only need to import one errors package.
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in err's chain that matches target, and if so, sets target to that
+// error value and returns true. It is errors.As from the standard library.
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Unwrap returns the result of calling the Unwrap method on err, if err's type contains an Unwrap
+// method returning error. Otherwise, Unwrap returns nil. It is errors.Unwrap from the standard
+// library.
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
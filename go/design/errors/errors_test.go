@@ -0,0 +1,130 @@
+// Run test using "go test -v"
+
+// We are using errors_test for package name because we want to make sure we only touch the
+// exported API.
+package errors_test
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// appError is a custom error type like AppError in error_6.go.
+type appError struct {
+	State int
+}
+
+// Error implements the error interface.
+func (c *appError) Error() string {
+	return fmt.Sprintf("App Error, State: %d", c.State)
+}
+
+// TestWrap validates that wrapping keeps the root cause reachable.
+func TestWrap(t *testing.T) {
+	root := &appError{99}
+	err := errors.Wrapf(errors.Wrap(root, "secondCall->thirdCall()"), "firstCall->secondCall(%d)", 10)
+
+	t.Log("Given the need to wrap an error up the call stack.")
+	{
+		t.Logf("\tTest 0:\tWhen wrapping an *appError twice.")
+		{
+			want := "firstCall->secondCall(10): secondCall->thirdCall(): App Error, State: 99"
+			if err.Error() != want {
+				t.Fatalf("\t%s\tShould have every message in the chain : %q", failed, err.Error())
+			}
+			t.Logf("\t%s\tShould have every message in the chain.", succeed)
+
+			if errors.Cause(err) != root {
+				t.Fatalf("\t%s\tShould find the root with Cause : %v", failed, errors.Cause(err))
+			}
+			t.Logf("\t%s\tShould find the root with Cause.", succeed)
+
+			var ae *appError
+			if !stderrors.As(err, &ae) || ae.State != 99 {
+				t.Fatalf("\t%s\tShould find the root with the standard errors.As.", failed)
+			}
+			t.Logf("\t%s\tShould find the root with the standard errors.As.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen wrapping a sentinel error.")
+		{
+			err := errors.Wrap(io.EOF, "read")
+			if !errors.Is(err, io.EOF) || !stderrors.Is(err, io.EOF) {
+				t.Fatalf("\t%s\tShould match the sentinel with Is.", failed)
+			}
+			t.Logf("\t%s\tShould match the sentinel with Is.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen wrapping a nil error.")
+		{
+			if errors.Wrap(nil, "nothing") != nil || errors.WithCode(nil, "E1") != nil {
+				t.Fatalf("\t%s\tShould return nil.", failed)
+			}
+			t.Logf("\t%s\tShould return nil.", succeed)
+		}
+	}
+}
+
+// TestContext validates codes and fields can be attached and read back.
+func TestContext(t *testing.T) {
+	err := errors.New("connection refused")
+	err = errors.WithFields(err, "host", "localhost", "port", 5432)
+	err = errors.Wrap(err, "open database")
+	err = errors.WithCode(err, "DB_UNAVAILABLE")
+	err = errors.WithFields(err, "host", "db.internal")
+
+	t.Log("Given the need to attach structured context to an error.")
+	{
+		t.Logf("\tTest 0:\tWhen reading the code.")
+		{
+			if code := errors.Code(err); code != "DB_UNAVAILABLE" {
+				t.Fatalf("\t%s\tShould get the code back : %q", failed, code)
+			}
+			t.Logf("\t%s\tShould get the code back.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen reading the fields.")
+		{
+			fields := errors.Fields(err)
+			if len(fields) != 2 {
+				t.Fatalf("\t%s\tShould have 2 fields : %v", failed, fields)
+			}
+			t.Logf("\t%s\tShould have 2 fields.", succeed)
+
+			if fields[0].Key != "host" || fields[0].Value != "db.internal" {
+				t.Errorf("\t%s\tShould let the outermost host win : %v", failed, fields[0])
+			} else {
+				t.Logf("\t%s\tShould let the outermost host win.", succeed)
+			}
+		}
+
+		t.Logf("\tTest 2:\tWhen formatting with %%+v.")
+		{
+			s := fmt.Sprintf("%+v", err)
+
+			for _, want := range []string{"connection refused", "host=localhost port=5432", "open database", "code=DB_UNAVAILABLE", "TestContext"} {
+				if !strings.Contains(s, want) {
+					t.Errorf("\t%s\tShould contain %q : %s", failed, want, s)
+					continue
+				}
+				t.Logf("\t%s\tShould contain %q.", succeed, want)
+			}
+
+			if fmt.Sprintf("%v", err) != "open database: connection refused" {
+				t.Errorf("\t%s\tShould only have the messages with %%v : %v", failed, err)
+			} else {
+				t.Logf("\t%s\tShould only have the messages with %%v.", succeed)
+			}
+		}
+	}
+}
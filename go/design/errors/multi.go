@@ -0,0 +1,149 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Multi collects the errors of many operations, usually run by many Goroutines, into one error.
+// The zero value is ready to use, with "operation" as the name of an operation. It is safe for
+// concurrent use and must not be copied after first use.
+type Multi struct {
+	// Op names one operation in the summary, like "insert" in "3 inserts failed".
+	Op string
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// Append adds err to m. A nil err is ignored, so the result of every operation can be passed in.
+// Every error is kept, even when it has the same cause as one already added, so Is, As, Code and
+// Fields can find any of them.
+func (m *Multi) Append(err error) {
+	if err == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.errs = append(m.errs, err)
+}
+
+// Len returns how many errors were appended.
+func (m *Multi) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.errs)
+}
+
+// Errors returns every error, in the order they were appended.
+func (m *Multi) Errors() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]error(nil), m.errs...)
+}
+
+// Unwrap returns every error so Is and As look at all of them.
+func (m *Multi) Unwrap() []error {
+	return m.Errors()
+}
+
+// Err returns m as an error, or nil when nothing was appended. Always return Err and not m
+// itself: a nil *Multi stored in the error interface is not nil, this is the trap in error_5.go.
+func (m *Multi) Err() error {
+	if m.Len() == 0 {
+		return nil
+	}
+
+	return m
+}
+
+// Error returns a summary grouped by cause, like
+// "3 inserts failed: Unable to insert 1 (x2); Unable to insert 4".
+// When the errors of a group wrap the cause with different messages, every one of those messages
+// is listed, like "2 components failed: disk full (x2: db failed, api failed)".
+func (m *Multi) Error() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op := m.Op
+	if op == "" {
+		op = "operation"
+	}
+	if len(m.errs) != 1 {
+		op += "s"
+	}
+
+	groups := groupByCause(m.errs)
+
+	msgs := make([]string, len(groups))
+	for i, g := range groups {
+		msgs[i] = g.String()
+	}
+
+	return fmt.Sprintf("%d %s failed: %s", len(m.errs), op, strings.Join(msgs, "; "))
+}
+
+// group is one distinct cause and every error that had it.
+type group struct {
+	cause error
+	errs  []error
+}
+
+// groupByCause returns the errors grouped by cause, in the order the causes first appear. Two
+// causes are the same when they have the same type and message, so an error variable always
+// matches itself. Comparing the values would not do, fmt.Errorf returns a new pointer every time,
+// even for the same message.
+func groupByCause(errs []error) []*group {
+	var groups []*group
+	byKey := make(map[string]*group)
+
+	for _, err := range errs {
+		cause := Cause(err)
+		key := fmt.Sprintf("%T: %s", cause, cause.Error())
+
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{cause: cause}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.errs = append(g.errs, err)
+	}
+
+	return groups
+}
+
+// String returns the message of the group: the message of its errors when they all have the same,
+// or the cause followed by what every error added to it.
+func (g *group) String() string {
+	var msgs []string
+	seen := make(map[string]bool)
+	for _, err := range g.errs {
+		if msg := err.Error(); !seen[msg] {
+			seen[msg] = true
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) == 1 {
+		if len(g.errs) == 1 {
+			return msgs[0]
+		}
+		return fmt.Sprintf("%s (x%d)", msgs[0], len(g.errs))
+	}
+
+	// "db failed: disk full" added "db failed" to the cause.
+	cause := g.cause.Error()
+	for i, msg := range msgs {
+		if ctx := strings.TrimSuffix(msg, ": "+cause); ctx != msg {
+			msgs[i] = ctx
+		}
+	}
+
+	return fmt.Sprintf("%s (x%d: %s)", cause, len(g.errs), strings.Join(msgs, ", "))
+}
@@ -0,0 +1,112 @@
+package errors_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// TestMulti validates errors appended from many Goroutines come back as one error.
+func TestMulti(t *testing.T) {
+	t.Log("Given the need to collect the errors of concurrent operations.")
+	{
+		t.Logf("\tTest 0:\tWhen nothing failed.")
+		{
+			var m errors.Multi
+			m.Append(nil)
+
+			if err := m.Err(); err != nil {
+				t.Fatalf("\t%s\tShould get a nil error : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould get a nil error.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen 20 Goroutines fail with 3 causes.")
+		{
+			m := errors.Multi{Op: "insert"}
+
+			var wg sync.WaitGroup
+			wg.Add(20)
+			for i := 0; i < 20; i++ {
+				go func(id int) {
+					defer wg.Done()
+
+					switch id % 4 {
+					case 0:
+						m.Append(errors.Wrapf(io.ErrUnexpectedEOF, "insert %d", id))
+					case 1:
+						m.Append(&appError{State: 1})
+					case 2:
+						m.Append(fmt.Errorf("Unable to insert into USER table"))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			err := m.Err()
+			if err == nil || m.Len() != 15 {
+				t.Fatalf("\t%s\tShould count 15 failures : %d", failed, m.Len())
+			}
+			t.Logf("\t%s\tShould count 15 failures.", succeed)
+
+			if len(m.Errors()) != 15 {
+				t.Fatalf("\t%s\tShould keep every error : %v", failed, m.Errors())
+			}
+			t.Logf("\t%s\tShould keep every error.", succeed)
+
+			var ae *appError
+			if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.As(err, &ae) {
+				t.Fatalf("\t%s\tShould find every member with Is and As.", failed)
+			}
+			t.Logf("\t%s\tShould find every member with Is and As.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen rendering the summary.")
+		{
+			m := errors.Multi{Op: "insert"}
+			m.Append(fmt.Errorf("Unable to insert 1"))
+			m.Append(fmt.Errorf("Unable to insert 1"))
+			m.Append(fmt.Errorf("Unable to insert 4"))
+
+			want := "3 inserts failed: Unable to insert 1 (x2); Unable to insert 4"
+			if m.Error() != want {
+				t.Fatalf("\t%s\tShould group by cause : %q", failed, m.Error())
+			}
+			t.Logf("\t%s\tShould group by cause.", succeed)
+		}
+
+		t.Logf("\tTest 3:\tWhen two errors wrap the same cause differently.")
+		{
+			errDisk := fmt.Errorf("disk full")
+
+			m := errors.Multi{Op: "component"}
+			m.Append(errors.WithCode(errors.Wrapf(errDisk, "db failed"), "DB"))
+			m.Append(errors.WithCode(errors.WithFields(errors.Wrapf(errDisk, "api failed"), "port", 80), "API"))
+
+			errs := m.Errors()
+			if len(errs) != 2 || errors.Code(errs[0]) != "DB" || errors.Code(errs[1]) != "API" {
+				t.Fatalf("\t%s\tShould keep both errors with their codes : %v", failed, errs)
+			}
+			t.Logf("\t%s\tShould keep both errors with their codes.", succeed)
+
+			if f := errors.Fields(errs[1]); len(f) != 1 || f[0].Value != 80 {
+				t.Fatalf("\t%s\tShould keep the fields of the second error : %v", failed, f)
+			}
+			t.Logf("\t%s\tShould keep the fields of the second error.", succeed)
+
+			if !errors.Is(m.Err(), errDisk) {
+				t.Fatalf("\t%s\tShould find the cause with Is.", failed)
+			}
+			t.Logf("\t%s\tShould find the cause with Is.", succeed)
+
+			want := "2 components failed: disk full (x2: db failed, api failed)"
+			if m.Error() != want {
+				t.Fatalf("\t%s\tShould list how each error wrapped the cause : %q", failed, m.Error())
+			}
+			t.Logf("\t%s\tShould list how each error wrapped the cause.", succeed)
+		}
+	}
+}
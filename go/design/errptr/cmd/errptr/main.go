@@ -0,0 +1,21 @@
+// Command errptr runs the errptr analyzer as a standalone vet-style tool.
+//
+// errptr is a module of its own, so golang.org/x/tools is not a dependency of the lessons. Run it
+// by its module path from the root of the repository:
+//
+//	go run github.com/hoanhan101/ultimate-go/go/design/errptr/cmd/errptr@latest ./go/design/error_5.go
+//
+// It can also be installed and used as a vet tool:
+//
+//	go install github.com/hoanhan101/ultimate-go/go/design/errptr/cmd/errptr@latest
+//	go vet -vettool=$(go env GOPATH)/bin/errptr ./...
+package main
+
+import (
+	"github.com/hoanhan101/ultimate-go/go/design/errptr"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(errptr.Analyzer)
+}
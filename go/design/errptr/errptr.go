@@ -0,0 +1,526 @@
+// Package errptr provides an analyzer that finds the nil typed error trap shown in error_5.go.
+//
+// A function that returns a concrete error type like *customError instead of the error interface
+// returns a nil pointer on success. The moment that nil pointer is stored inside an error
+// interface value, the interface is no longer nil: its first word is *customError. Checking
+// err != nil is true and the program takes the failure path.
+//
+// Returning a concrete pointer is fine when it is never nil, like a constructor returning
+// &Problem{}. So the analyzer only reports what can really be a nil pointer:
+//   - functions and function literals that return nil, or a pointer that can be nil, as a
+//     pointer to a type implementing error.
+//   - assignments, variable declarations and returns that store such a pointer into an error
+//     interface: the result of one of those functions, or a variable that is nil when declared
+//     or is assigned one.
+//
+// Pointers it can't tell anything about, like parameters, receivers, fields or variables whose
+// address is taken, are not reported.
+package errptr
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Analyzer finds concrete error pointers that can end up as non-nil error interfaces.
+var Analyzer = &analysis.Analyzer{
+	Name:      "errptr",
+	Doc:       "report nil concrete error pointers returned or stored as the error interface",
+	Requires:  []*analysis.Analyzer{inspect.Analyzer},
+	Run:       run,
+	FactTypes: []analysis.Fact{new(nilResults)},
+}
+
+// nilResults is the fact exported for a function with concrete error pointer results that can be
+// nil. It lets packages calling the function know about it.
+type nilResults struct {
+	Index []int // positions of the results that can be nil
+}
+
+// AFact marks nilResults as a fact.
+func (*nilResults) AFact() {}
+
+// errorType is the predeclared error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	c := checker{
+		pass:    pass,
+		vars:    make(map[*types.Var]*variable),
+		results: make(map[*types.Func][]bool),
+	}
+	c.collect(ins)
+	c.solve(ins)
+
+	nodes := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.FuncLit)(nil),
+		(*ast.AssignStmt)(nil),
+		(*ast.ValueSpec)(nil),
+		(*ast.ReturnStmt)(nil),
+	}
+
+	// The stack lets a return statement find the function it belongs to.
+	ins.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				c.checkResults(n.Name.Name, n.Type, c.nilResults(n.Type, n.Body))
+			}
+
+		case *ast.FuncLit:
+			c.checkResults("function literal", n.Type, c.nilResults(n.Type, n.Body))
+
+		case *ast.AssignStmt:
+			c.checkAssign(n.Lhs, n.Rhs)
+
+		case *ast.ValueSpec:
+			if n.Type != nil {
+				c.checkAssign(identExprs(n.Names), n.Values)
+			}
+
+		case *ast.ReturnStmt:
+			if ft := enclosingFunc(stack); ft != nil {
+				c.checkReturn(ft, n)
+			}
+		}
+
+		return true
+	})
+
+	return nil, nil
+}
+
+// isErrorPtr reports whether t is a pointer to a type that implements error.
+func isErrorPtr(t types.Type) bool {
+	if _, ok := t.Underlying().(*types.Pointer); !ok {
+		return false
+	}
+
+	return types.Implements(t, errorType)
+}
+
+// value is something stored into a variable, a result or an interface: expr, or the result index
+// of expr when index is not -1 and expr is a call with more than one result.
+type value struct {
+	expr  ast.Expr
+	index int
+}
+
+// variable is what the package does with a local concrete error pointer variable.
+type variable struct {
+	zero     bool    // declared without a value, so it starts as nil
+	unknown  bool    // its address is taken or it is set in ways we don't follow
+	assigned []value // every value assigned to it
+}
+
+// checker holds what the analyzer learned about the package.
+type checker struct {
+	pass    *analysis.Pass
+	vars    map[*types.Var]*variable
+	results map[*types.Func][]bool // results that can be nil, for the functions of this package
+}
+
+// variable returns the record for the object of id, creating it if it is a local concrete error
+// pointer variable, and nil otherwise.
+func (c *checker) variable(id *ast.Ident) *variable {
+	obj, ok := c.pass.TypesInfo.ObjectOf(id).(*types.Var)
+	if !ok || obj.Pkg() != c.pass.Pkg || obj.IsField() || obj.Parent() == obj.Pkg().Scope() || !isErrorPtr(obj.Type()) {
+		return nil
+	}
+
+	v, ok := c.vars[obj]
+	if !ok {
+		v = &variable{}
+		c.vars[obj] = v
+	}
+
+	return v
+}
+
+// collect records every declaration and assignment of the local concrete error pointer variables.
+// Parameters and receivers are never declared here, so they stay unknown.
+func (c *checker) collect(ins *inspector.Inspector) {
+	nodes := []ast.Node{
+		(*ast.ValueSpec)(nil),
+		(*ast.AssignStmt)(nil),
+		(*ast.UnaryExpr)(nil),
+		(*ast.RangeStmt)(nil),
+		(*ast.FuncType)(nil),
+	}
+
+	ins.Preorder(nodes, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			c.assign(identExprs(n.Names), n.Values)
+
+		case *ast.AssignStmt:
+			c.assign(n.Lhs, n.Rhs)
+
+		case *ast.UnaryExpr:
+			if id, ok := astutil.Unparen(n.X).(*ast.Ident); ok && n.Op == token.AND {
+				if v := c.variable(id); v != nil {
+					v.unknown = true
+				}
+			}
+
+		case *ast.RangeStmt:
+			for _, e := range []ast.Expr{n.Key, n.Value} {
+				if id, ok := e.(*ast.Ident); ok {
+					if v := c.variable(id); v != nil {
+						v.unknown = true
+					}
+				}
+			}
+
+		case *ast.FuncType:
+			// Named results start as nil, like variables declared without a value.
+			if n.Results == nil {
+				return
+			}
+			for _, field := range n.Results.List {
+				for _, name := range field.Names {
+					if v := c.variable(name); v != nil {
+						v.zero = true
+					}
+				}
+			}
+		}
+	})
+}
+
+// assign records the values of rhs stored into the variables of lhs.
+func (c *checker) assign(lhs, rhs []ast.Expr) {
+	for i, e := range lhs {
+		id, ok := astutil.Unparen(e).(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		v := c.variable(id)
+		if v == nil {
+			continue
+		}
+
+		switch {
+		case len(rhs) == 0:
+			v.zero = true
+		case len(rhs) == len(lhs):
+			v.assigned = append(v.assigned, value{rhs[i], -1})
+		case len(rhs) == 1:
+			v.assigned = append(v.assigned, value{rhs[0], i})
+		}
+	}
+}
+
+// solve finds the results of the functions of the package that can be nil, and exports them as
+// facts. A function returning the result of another one can only be decided after that one, so
+// it goes over them until nothing changes.
+func (c *checker) solve(ins *inspector.Inspector) {
+	var funcs []*ast.FuncDecl
+	ins.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		if fd := n.(*ast.FuncDecl); fd.Body != nil {
+			funcs = append(funcs, fd)
+		}
+	})
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, fd := range funcs {
+			fn, ok := c.pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+
+			// Results only ever go from not nil to nil, counting them is enough to see a change.
+			res := c.nilResults(fd.Type, fd.Body)
+			if count(res) != count(c.results[fn]) {
+				c.results[fn] = res
+				changed = true
+			}
+		}
+	}
+
+	for fn, res := range c.results {
+		var fact nilResults
+		for i, isNil := range res {
+			if isNil {
+				fact.Index = append(fact.Index, i)
+			}
+		}
+		if len(fact.Index) > 0 {
+			c.pass.ExportObjectFact(fn, &fact)
+		}
+	}
+}
+
+// resultTypes returns the type of every result of ft, one per result even when they share a
+// field.
+func (c *checker) resultTypes(ft *ast.FuncType) []types.Type {
+	if ft.Results == nil {
+		return nil
+	}
+
+	var results []types.Type
+	for _, field := range ft.Results.List {
+		t := c.pass.TypesInfo.TypeOf(field.Type)
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			results = append(results, t)
+		}
+	}
+
+	return results
+}
+
+// nilResults reports for every result of a function if it is a concrete error pointer that one of
+// the return statements in body can leave nil.
+func (c *checker) nilResults(ft *ast.FuncType, body *ast.BlockStmt) []bool {
+	results := c.resultTypes(ft)
+	res := make([]bool, len(results))
+	if len(results) == 0 {
+		return res
+	}
+
+	// A bare return returns the named results as they are.
+	var named []ast.Expr
+	for _, field := range ft.Results.List {
+		named = append(named, identExprs(field.Names)...)
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			// Its returns are its own.
+			return false
+
+		case *ast.ReturnStmt:
+			rhs := n.Results
+			if len(rhs) == 0 {
+				rhs = named
+			}
+
+			for i, t := range results {
+				if t == nil || !isErrorPtr(t) {
+					continue
+				}
+
+				switch {
+				case len(rhs) == len(results):
+					res[i] = res[i] || c.mayBeNil(value{rhs[i], -1}, nil)
+				case len(rhs) == 1:
+					res[i] = res[i] || c.mayBeNil(value{rhs[0], i}, nil)
+				}
+			}
+		}
+
+		return true
+	})
+
+	return res
+}
+
+// mayBeNil reports whether v is known to be a nil pointer at least some of the time. seen stops
+// variables assigned to each other from looping forever.
+func (c *checker) mayBeNil(v value, seen map[*variable]bool) bool {
+	expr := astutil.Unparen(v.expr)
+
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if v.index == -1 && c.pass.TypesInfo.Types[e].IsNil() {
+			return true
+		}
+
+		vr := c.variable(e)
+		if vr == nil || vr.unknown || seen[vr] {
+			return false
+		}
+		if vr.zero {
+			return true
+		}
+
+		if seen == nil {
+			seen = make(map[*variable]bool)
+		}
+		seen[vr] = true
+
+		for _, a := range vr.assigned {
+			if c.mayBeNil(a, seen) {
+				return true
+			}
+		}
+
+	case *ast.CallExpr:
+		fn := typeutil.StaticCallee(c.pass.TypesInfo, e)
+		if fn == nil {
+			return false
+		}
+
+		index := v.index
+		if index == -1 {
+			index = 0
+		}
+
+		if fn.Pkg() == c.pass.Pkg {
+			res := c.results[fn.Origin()]
+			return index < len(res) && res[index]
+		}
+
+		var fact nilResults
+		if c.pass.ImportObjectFact(fn.Origin(), &fact) {
+			for _, i := range fact.Index {
+				if i == index {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// checkResults reports every result of a function that is a concrete error pointer which can be
+// nil. res has one entry per result, see nilResults.
+func (c *checker) checkResults(name string, ft *ast.FuncType, res []bool) {
+	if ft.Results == nil {
+		return
+	}
+
+	i := 0
+	for _, field := range ft.Results.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+
+		for _, isNil := range res[i : i+n] {
+			if isNil {
+				t := c.pass.TypesInfo.TypeOf(field.Type)
+				c.pass.Reportf(field.Type.Pos(), "%s returns concrete error type %s, return the error interface instead", name, typeString(c.pass, t))
+				break
+			}
+		}
+		i += n
+	}
+}
+
+// checkAssign reports every nil concrete error pointer stored into an error interface.
+func (c *checker) checkAssign(lhs, rhs []ast.Expr) {
+	switch {
+	case len(lhs) == len(rhs):
+		for i := range lhs {
+			c.check(c.pass.TypesInfo.TypeOf(lhs[i]), value{rhs[i], -1}, c.pass.TypesInfo.TypeOf(rhs[i]))
+		}
+
+	case len(rhs) == 1:
+		// _, err = fail() assigns every element of a tuple.
+		tuple, ok := c.pass.TypesInfo.TypeOf(rhs[0]).(*types.Tuple)
+		if !ok || tuple.Len() != len(lhs) {
+			return
+		}
+
+		for i := range lhs {
+			c.check(c.pass.TypesInfo.TypeOf(lhs[i]), value{rhs[0], i}, tuple.At(i).Type())
+		}
+	}
+}
+
+// checkReturn reports every nil concrete error pointer returned as an error interface.
+func (c *checker) checkReturn(ft *ast.FuncType, ret *ast.ReturnStmt) {
+	results := c.resultTypes(ft)
+	rhs := ret.Results
+
+	switch {
+	case len(rhs) == len(results):
+		for i := range rhs {
+			c.check(results[i], value{rhs[i], -1}, c.pass.TypesInfo.TypeOf(rhs[i]))
+		}
+
+	case len(rhs) == 1:
+		tuple, ok := c.pass.TypesInfo.TypeOf(rhs[0]).(*types.Tuple)
+		if !ok || tuple.Len() != len(results) {
+			return
+		}
+
+		for i := range results {
+			c.check(results[i], value{rhs[0], i}, tuple.At(i).Type())
+		}
+	}
+}
+
+// check reports v when a value of type from is stored into type to and it is a concrete error
+// pointer that can be nil.
+func (c *checker) check(to types.Type, v value, from types.Type) {
+	if to == nil || from == nil {
+		return
+	}
+
+	// Only interfaces that have the Error method, like error itself, are a trap.
+	if !types.IsInterface(to) || !types.Implements(to, errorType) {
+		return
+	}
+
+	if !isErrorPtr(from) || !c.mayBeNil(v, nil) {
+		return
+	}
+
+	c.pass.Reportf(v.expr.Pos(), "concrete error type %s stored in %s interface is never nil, even when the pointer is", typeString(c.pass, from), typeString(c.pass, to))
+}
+
+// count returns how many of res are true.
+func count(res []bool) int {
+	n := 0
+	for _, isNil := range res {
+		if isNil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// identExprs returns the identifiers as expressions.
+func identExprs(ids []*ast.Ident) []ast.Expr {
+	exprs := make([]ast.Expr, len(ids))
+	for i, id := range ids {
+		exprs[i] = id
+	}
+
+	return exprs
+}
+
+// enclosingFunc returns the type of the innermost function on the stack.
+func enclosingFunc(stack []ast.Node) *ast.FuncType {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch f := stack[i].(type) {
+		case *ast.FuncDecl:
+			return f.Type
+		case *ast.FuncLit:
+			return f.Type
+		}
+	}
+
+	return nil
+}
+
+// typeString returns t as it would be written inside the package being analyzed.
+func typeString(pass *analysis.Pass, t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(pass.Pkg))
+}
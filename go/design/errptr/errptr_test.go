@@ -0,0 +1,16 @@
+// Run test using "go test -run TestAnalyzer"
+
+package errptr_test
+
+import (
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errptr"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// TestAnalyzer runs the analyzer over testdata/src/a and b and checks every diagnostic and fact
+// against the want comments in the source.
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), errptr.Analyzer, "a", "b")
+}
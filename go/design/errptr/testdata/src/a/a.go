@@ -0,0 +1,108 @@
+package a
+
+import "errors"
+
+type customError struct{}
+
+func (c *customError) Error() string {
+	return "Find the bug."
+}
+
+// fail is the function from error_5.go.
+func fail() ([]byte, *customError) { // want fail:`&{\[1\]}` `fail returns concrete error type \*customError, return the error interface instead`
+	return nil, nil
+}
+
+// ok returns the error interface, this is what we want.
+func ok() ([]byte, error) {
+	return nil, nil
+}
+
+func assign() {
+	var err error
+
+	if _, err = fail(); err != nil { // want `concrete error type \*customError stored in error interface is never nil, even when the pointer is`
+		return
+	}
+
+	var ce *customError
+	err = ce // want `concrete error type \*customError stored in error interface is never nil, even when the pointer is`
+
+	var err2 error = ce // want `concrete error type \*customError stored in error interface is never nil, even when the pointer is`
+
+	// These can never be nil, so they are fine.
+	err = &customError{}
+	err = new(customError)
+	err = errors.New("bad")
+
+	_, _ = err, err2
+}
+
+func returns() error {
+	var ce *customError
+	if ce == nil {
+		return ce // want `concrete error type \*customError stored in error interface is never nil, even when the pointer is`
+	}
+
+	return &customError{}
+}
+
+func literal() {
+	f := func() *customError { // want `function literal returns concrete error type \*customError, return the error interface instead`
+		return nil
+	}
+	_ = f
+}
+
+// Fail is fail for other packages.
+func Fail() *customError { // want Fail:`&{\[0\]}` `Fail returns concrete error type \*customError, return the error interface instead`
+	_, ce := fail()
+	return ce
+}
+
+// named leaves its named result nil.
+func named() (ce *customError) { // want named:`&{\[0\]}` `named returns concrete error type \*customError, return the error interface instead`
+	return
+}
+
+// Constructors that never return nil are fine, and so is storing what they return in an error.
+
+func newCustom() *customError {
+	return &customError{}
+}
+
+func newCustomVar() *customError {
+	ce := new(customError)
+	return ce
+}
+
+func newCustomCall() *customError {
+	return newCustom()
+}
+
+// find can't be decided: errors.As sets ce through its address.
+func find(err error) *customError {
+	var ce *customError
+	if errors.As(err, &ce) {
+		return ce
+	}
+
+	return &customError{}
+}
+
+// Err returns the receiver, we don't know anything about it.
+func (c *customError) Err() error {
+	return c
+}
+
+func constructors(in error) error {
+	var err error = newCustom()
+	err = newCustomVar()
+	_ = err
+
+	if err := find(in); err != nil {
+		return err
+	}
+
+	return newCustomCall()
+}
@@ -0,0 +1,8 @@
+package b
+
+import "a"
+
+// b only knows about a.Fail through the fact a exports.
+func b() error {
+	return a.Fail() // want `concrete error type \*a.customError stored in error interface is never nil, even when the pointer is`
+}
@@ -0,0 +1,237 @@
+// Package lifecycle runs a set of components, like the Server in pollution_2.go, for the life of
+// a program.
+//
+// pollution_2.go removed the Server interface because there was only one implementation. A
+// supervisor is the opposite case: it runs many different implementations, so it declares the
+// small interface it needs, Component, and any type with those methods can be added.
+//
+// Run starts the components so every one starts after the ones it depends on, then waits. On a
+// signal, on a cancelled context or when any component fails, it stops them in the reverse order
+// and gives them Timeout to finish.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// Component is anything that can be started, stopped and waited on.
+// Start must return once the component is running. Wait blocks until it is done and returns why.
+// Stop asks it to finish, Wait returns nil after that unless something went wrong.
+type Component interface {
+	Start() error
+	Stop() error
+	Wait() error
+}
+
+// ErrTimeout is returned when the components did not stop before the Timeout.
+var ErrTimeout = errors.New("lifecycle: shutdown timed out")
+
+// DefaultTimeout is used when Supervisor.Timeout is 0.
+const DefaultTimeout = 30 * time.Second
+
+// Supervisor runs components. Add them all, then call Run once.
+type Supervisor struct {
+	Timeout time.Duration // How long the components have to stop.
+	Signals []os.Signal   // Signals that start a shutdown. Interrupt and SIGTERM when empty.
+
+	units []*unit
+	names map[string]*unit
+}
+
+// unit is one component and what Run knows about it.
+type unit struct {
+	name string
+	c    Component
+	deps []string
+
+	done chan struct{} // closed when Wait returns
+	err  error         // what Wait returned
+}
+
+// Add adds a component under a name. It is started after the components named in dependsOn and
+// stopped before them.
+func (s *Supervisor) Add(name string, c Component, dependsOn ...string) {
+	if s.names == nil {
+		s.names = make(map[string]*unit)
+	}
+
+	u := unit{
+		name: name,
+		c:    c,
+		deps: dependsOn,
+		done: make(chan struct{}),
+	}
+
+	s.units = append(s.units, &u)
+	s.names[name] = &u
+}
+
+// order returns the units so every one comes after its dependencies. Units that don't depend on
+// each other keep the order they were added in.
+func (s *Supervisor) order() ([]*unit, error) {
+	if len(s.names) != len(s.units) {
+		return nil, errors.New("lifecycle: a name was added twice")
+	}
+
+	placed := make(map[*unit]bool)
+	var order []*unit
+
+	for len(order) < len(s.units) {
+		progress := false
+
+		for _, u := range s.units {
+			if placed[u] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range u.deps {
+				d, ok := s.names[dep]
+				if !ok {
+					return nil, fmt.Errorf("lifecycle: %s depends on unknown %s", u.name, dep)
+				}
+				if !placed[d] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				placed[u] = true
+				order = append(order, u)
+				progress = true
+			}
+		}
+
+		if !progress {
+			return nil, errors.New("lifecycle: dependency cycle")
+		}
+	}
+
+	return order, nil
+}
+
+// Run starts every component and blocks until they are all stopped. It returns nil when the
+// shutdown came from a signal or ctx and every component stopped cleanly. Otherwise the error
+// has every failure in it, see errors.Multi.
+func (s *Supervisor) Run(ctx context.Context) error {
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+
+	sigs := s.Signals
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+	defer signal.Stop(sigCh)
+
+	failed := make(chan *unit, len(order))
+	m := errors.Multi{Op: "component"}
+
+	// Start in order. If one can't start, the ones already running are stopped.
+	var started []*unit
+	for _, u := range order {
+		if err := u.c.Start(); err != nil {
+			m.Append(errors.Wrapf(err, "start %s", u.name))
+			break
+		}
+		started = append(started, u)
+
+		go func(u *unit) {
+			u.err = u.c.Wait()
+			close(u.done)
+
+			if u.err != nil {
+				failed <- u
+			}
+		}(u)
+	}
+
+	// The failure that started the shutdown goes first in the error.
+	var trigger *unit
+	if m.Len() == 0 {
+		select {
+		case <-ctx.Done():
+		case <-sigCh:
+		case trigger = <-failed:
+			m.Append(errors.Wrapf(trigger.err, "%s failed", trigger.name))
+		case <-s.allDone(started):
+		}
+	}
+
+	s.shutdown(started, trigger, &m)
+
+	return m.Err()
+}
+
+// allDone returns a channel that is closed when every unit finished on its own.
+func (s *Supervisor) allDone(units []*unit) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		for _, u := range units {
+			<-u.done
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// shutdown stops the units in reverse order. A unit is stopped only once the ones started after it
+// are done. It adds to m every error but the one of trigger, and ErrTimeout if the Timeout passes
+// first; the components still running then are left behind.
+func (s *Supervisor) shutdown(units []*unit, trigger *unit, m *errors.Multi) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	// The errors are only added to m once everything stopped, so the error Run returned does not
+	// change if the units left behind fail later.
+	var errs []error
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		for i := len(units) - 1; i >= 0; i-- {
+			u := units[i]
+
+			select {
+			case <-u.done:
+				// It is already down.
+			default:
+				if err := u.c.Stop(); err != nil {
+					errs = append(errs, errors.Wrapf(err, "stop %s", u.name))
+				}
+				<-u.done
+			}
+
+			if u.err != nil && u != trigger {
+				errs = append(errs, errors.Wrapf(u.err, "%s failed", u.name))
+			}
+		}
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-stopped:
+		for _, err := range errs {
+			m.Append(err)
+		}
+	case <-t.C:
+		m.Append(ErrTimeout)
+	}
+}
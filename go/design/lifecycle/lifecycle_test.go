@@ -0,0 +1,182 @@
+// Run test using "go test -v -race"
+
+package lifecycle_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+	"github.com/hoanhan101/ultimate-go/go/design/lifecycle"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// journal records what the components did, in order.
+type journal struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (j *journal) add(event string) {
+	j.mu.Lock()
+	j.events = append(j.events, event)
+	j.mu.Unlock()
+}
+
+func (j *journal) String() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return strings.Join(j.events, " ")
+}
+
+// server is a component like the Server in pollution_2.go.
+type server struct {
+	name     string
+	j        *journal
+	startErr error
+	hang     bool // ignores Stop
+
+	once sync.Once
+	quit chan error
+}
+
+func newServer(name string, j *journal) *server {
+	return &server{name: name, j: j, quit: make(chan error, 1)}
+}
+
+func (s *server) Start() error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	s.j.add("start:" + s.name)
+	return nil
+}
+
+func (s *server) Stop() error {
+	s.j.add("stop:" + s.name)
+	if !s.hang {
+		s.fail(nil)
+	}
+	return nil
+}
+
+func (s *server) Wait() error {
+	return <-s.quit
+}
+
+// fail makes Wait return err.
+func (s *server) fail(err error) {
+	s.once.Do(func() { s.quit <- err })
+}
+
+// TestRun validates the order components are started and stopped in.
+func TestRun(t *testing.T) {
+	t.Log("Given the need to run components that depend on each other.")
+	{
+		t.Logf("\tTest 0:\tWhen the context is cancelled.")
+		{
+			var j journal
+			var s lifecycle.Supervisor
+			s.Add("api", newServer("api", &j), "db", "cache")
+			s.Add("db", newServer("db", &j))
+			s.Add("cache", newServer("cache", &j), "db")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+
+			if err := s.Run(ctx); err != nil {
+				t.Fatalf("\t%s\tShould stop cleanly : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould stop cleanly.", succeed)
+
+			want := "start:db start:cache start:api stop:api stop:cache stop:db"
+			if j.String() != want {
+				t.Fatalf("\t%s\tShould start in dependency order and stop in reverse : %s", failed, j.String())
+			}
+			t.Logf("\t%s\tShould start in dependency order and stop in reverse.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen a component fails.")
+		{
+			var j journal
+			db, api := newServer("db", &j), newServer("api", &j)
+
+			var s lifecycle.Supervisor
+			s.Add("db", db)
+			s.Add("api", api, "db")
+
+			errDisk := errors.New("disk full")
+			time.AfterFunc(20*time.Millisecond, func() { db.fail(errDisk) })
+
+			err := s.Run(context.Background())
+			if !errors.Is(err, errDisk) || !strings.HasPrefix(err.Error(), "1 component failed: db failed") {
+				t.Fatalf("\t%s\tShould return the failure : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return the failure.", succeed)
+
+			if j.String() != "start:db start:api stop:api" {
+				t.Fatalf("\t%s\tShould stop the others : %s", failed, j.String())
+			}
+			t.Logf("\t%s\tShould stop the others.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen a component can't start.")
+		{
+			var j journal
+			api := newServer("api", &j)
+			api.startErr = fmt.Errorf("address in use")
+
+			var s lifecycle.Supervisor
+			s.Add("db", newServer("db", &j))
+			s.Add("api", api, "db")
+
+			if err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "start api: address in use") {
+				t.Fatalf("\t%s\tShould return the start error : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return the start error.", succeed)
+
+			if j.String() != "start:db stop:db" {
+				t.Fatalf("\t%s\tShould stop what was started : %s", failed, j.String())
+			}
+			t.Logf("\t%s\tShould stop what was started.", succeed)
+		}
+
+		t.Logf("\tTest 3:\tWhen a component does not stop.")
+		{
+			var j journal
+			db := newServer("db", &j)
+			db.hang = true
+
+			s := lifecycle.Supervisor{Timeout: 50 * time.Millisecond}
+			s.Add("db", db)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if err := s.Run(ctx); !errors.Is(err, lifecycle.ErrTimeout) {
+				t.Fatalf("\t%s\tShould time out : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould time out.", succeed)
+		}
+
+		t.Logf("\tTest 4:\tWhen the dependencies are wrong.")
+		{
+			var s lifecycle.Supervisor
+			s.Add("a", newServer("a", nil), "b")
+			s.Add("b", newServer("b", nil), "a")
+
+			if err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "cycle") {
+				t.Fatalf("\t%s\tShould find the cycle : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould find the cycle.", succeed)
+		}
+	}
+}
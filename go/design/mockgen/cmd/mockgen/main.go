@@ -0,0 +1,52 @@
+// Command mockgen writes a recording mock for an interface.
+//
+// Run: `go run ./go/design/mockgen/cmd/mockgen -i publisher ./go/design/mocking_2.go`
+//
+// The mock is written to standard output, or to the file given with -o:
+//
+//	go run ./go/design/mockgen/cmd/mockgen -i publisher -mock mock -o publisher_mock_test.go client.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hoanhan101/ultimate-go/go/design/mockgen"
+)
+
+func main() {
+	var cfg mockgen.Config
+	flag.StringVar(&cfg.Interface, "i", "", "name of the interface to mock")
+	flag.StringVar(&cfg.Mock, "mock", "", "name of the mock type (default <interface>Mock)")
+	out := flag.String("o", "", "file to write the mock to (default standard output)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mockgen -i interface [-mock name] [-o file] file.go...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg.Files = flag.Args()
+	if cfg.Interface == "" || len(cfg.Files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := mockgen.Generate(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,325 @@
+// Package mockgen writes recording mocks for interfaces declared by their consumer.
+//
+// mocking_2.go shows the idea: the application declares the publisher interface it needs and
+// writes a mock for it by hand. Generate writes that mock instead. For every method M of the
+// interface, the mock has:
+//
+//   - M, which records the arguments of the call.
+//   - MReturns, which queues what the next call to M returns. Call it once per call to stub.
+//   - MFunc, a field that runs when no return is queued. Without it M returns zero values.
+//   - MCalls, which returns the recorded calls.
+//   - AssertMCalled and AssertMCalledWith, which fail a test unless M was called n times or
+//     called with the arguments.
+//
+// Only the syntax of the source is read, the interface does not have to be in a package that
+// builds on its own. Interfaces embedded in it must be declared in the same files, except error.
+package mockgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Config describes the mock to generate.
+type Config struct {
+	Interface string   // Name of the interface, like "publisher".
+	Mock      string   // Name of the mock type. Interface followed by Mock when empty.
+	Files     []string // Go files to look for the interface in, all of the same package.
+}
+
+// Generate returns the gofmt-ed source of the mock.
+func Generate(cfg Config) ([]byte, error) {
+	fset := token.NewFileSet()
+
+	var files []*ast.File
+	for _, name := range cfg.Files {
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("mockgen: no files to look for %s in", cfg.Interface)
+	}
+
+	g := generator{
+		fset:       fset,
+		interfaces: make(map[string]*ast.InterfaceType),
+		imports:    make(map[string]string),
+	}
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if it, ok := spec.Type.(*ast.InterfaceType); ok {
+						g.interfaces[spec.Name.Name] = it
+					}
+
+				case *ast.ImportSpec:
+					path, _ := strconv.Unquote(spec.Path.Value)
+					name := path[strings.LastIndex(path, "/")+1:]
+					if spec.Name != nil {
+						name = spec.Name.Name
+					}
+					g.imports[name] = path
+				}
+			}
+		}
+	}
+
+	mock := cfg.Mock
+	if mock == "" {
+		mock = cfg.Interface + "Mock"
+	}
+
+	data := mockData{
+		Package:   files[0].Name.Name,
+		Interface: cfg.Interface,
+		Mock:      mock,
+		Imports:   []string{`"sync"`},
+	}
+
+	methods, err := g.methods(cfg.Interface, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	data.Methods = methods
+
+	for _, m := range methods {
+		if len(m.Params) > 0 {
+			data.Imports = append(data.Imports, `"reflect"`)
+			break
+		}
+	}
+	data.Imports = append(data.Imports, g.usedImports()...)
+
+	var buf bytes.Buffer
+	if err := mockTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("mockgen: generated invalid code: %v", err)
+	}
+
+	return src, nil
+}
+
+// mockData is what the template needs for one mock.
+type mockData struct {
+	Package   string
+	Interface string
+	Mock      string
+	Imports   []string
+	Methods   []method
+}
+
+// method is one method of the interface.
+type method struct {
+	Name     string
+	Params   []field
+	Results  []field
+	Variadic bool
+}
+
+// field is one parameter or result. Name is the parameter name in the mock method, Field is the
+// exported name in the Call and Return structs.
+type field struct {
+	Name  string
+	Field string
+	Type  string
+}
+
+// generator collects what it finds in the source files.
+type generator struct {
+	fset       *token.FileSet
+	interfaces map[string]*ast.InterfaceType
+	imports    map[string]string // package name to path
+	seen       map[string]bool   // package names the signatures refer to
+}
+
+// reserved are the names the generated methods use in the scope of the parameters: their own
+// variables, the packages they import and the builtins they call. A parameter with one of these
+// names would shadow it.
+var reserved = map[string]bool{
+	"m": true, "r": true, "fn": true, "queued": true, "t": true, "want": true, "call": true,
+	"reflect": true, "sync": true,
+	"append": true, "len": true, "nil": true, "true": true, "false": true,
+}
+
+// methods returns every method of the named interface, including the embedded ones.
+func (g *generator) methods(name string, visiting map[string]bool) ([]method, error) {
+	it, ok := g.interfaces[name]
+	if !ok {
+		return nil, fmt.Errorf("mockgen: interface %s not found", name)
+	}
+
+	if visiting[name] {
+		return nil, fmt.Errorf("mockgen: interface %s embeds itself", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var methods []method
+	for _, f := range it.Methods.List {
+		ft, ok := f.Type.(*ast.FuncType)
+		if !ok {
+			// An embedded interface.
+			id, ok := f.Type.(*ast.Ident)
+			if !ok {
+				return nil, fmt.Errorf("mockgen: can't embed %s in a mock", g.expr(f.Type))
+			}
+
+			if id.Name == "error" {
+				methods = append(methods, method{
+					Name:    "Error",
+					Results: []field{{Field: "R0", Type: "string"}},
+				})
+				continue
+			}
+
+			embedded, err := g.methods(id.Name, visiting)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, embedded...)
+			continue
+		}
+
+		for _, n := range f.Names {
+			methods = append(methods, g.method(n.Name, ft))
+		}
+	}
+
+	return methods, nil
+}
+
+// method describes one method.
+func (g *generator) method(name string, ft *ast.FuncType) method {
+	m := method{Name: name}
+
+	// The names a renamed parameter must not take.
+	used := make(map[string]bool)
+	for _, p := range ft.Params.List {
+		for _, n := range p.Names {
+			used[n.Name] = true
+		}
+	}
+
+	i := 0
+	for _, p := range ft.Params.List {
+		typ := p.Type
+		if e, ok := typ.(*ast.Ellipsis); ok {
+			m.Variadic = true
+			typ = &ast.ArrayType{Elt: e.Elt}
+		}
+
+		names := p.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "_"}}
+		}
+
+		for _, n := range names {
+			param := n.Name
+			if param == "_" || reserved[param] {
+				param = fmt.Sprintf("arg%d", i)
+				for used[param] {
+					param += "_"
+				}
+				used[param] = true
+			}
+
+			m.Params = append(m.Params, field{
+				Name:  param,
+				Field: exported(param),
+				Type:  g.expr(typ),
+			})
+			i++
+		}
+	}
+
+	if ft.Results != nil {
+		i := 0
+		for _, r := range ft.Results.List {
+			n := len(r.Names)
+			if n == 0 {
+				n = 1
+			}
+
+			for j := 0; j < n; j++ {
+				m.Results = append(m.Results, field{
+					Field: fmt.Sprintf("R%d", i),
+					Type:  g.expr(r.Type),
+				})
+				i++
+			}
+		}
+	}
+
+	return m
+}
+
+// expr prints a type expression and remembers the packages it refers to.
+func (g *generator) expr(e ast.Expr) string {
+	ast.Inspect(e, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				if g.seen == nil {
+					g.seen = make(map[string]bool)
+				}
+				g.seen[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	printer.Fprint(&buf, g.fset, e)
+	return buf.String()
+}
+
+// usedImports returns the import lines for the packages the signatures refer to.
+func (g *generator) usedImports() []string {
+	var lines []string
+	for name := range g.seen {
+		path, ok := g.imports[name]
+		if !ok {
+			continue
+		}
+
+		if name == path[strings.LastIndex(path, "/")+1:] {
+			lines = append(lines, strconv.Quote(path))
+			continue
+		}
+		lines = append(lines, name+" "+strconv.Quote(path))
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+// exported returns name with its first letter in upper case.
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
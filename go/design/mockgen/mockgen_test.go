@@ -0,0 +1,130 @@
+// Run test using "go test -v"
+
+package mockgen_test
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/mockgen"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+//go:generate go run ./cmd/mockgen -i publisher -o publisher_mock_test.go mockgen_test.go
+
+// publisher is the interface from mocking_2.go.
+type publisher interface {
+	Publish(key string, v interface{}) error
+	Subscribe(key string) error
+}
+
+// TestMock validates the generated publisherMock records and stubs calls.
+func TestMock(t *testing.T) {
+	var m publisherMock
+	var p publisher = &m
+
+	t.Log("Given the need to mock the publisher interface.")
+	{
+		errFull := errors.New("full")
+		m.PublishReturns(nil)
+		m.PublishReturns(errFull)
+		m.PublishFunc = func(key string, v interface{}) error {
+			return errors.New("func")
+		}
+
+		p.Subscribe("orders")
+		errs := []error{
+			p.Publish("orders", 1),
+			p.Publish("orders", 2),
+			p.Publish("orders", 3),
+		}
+
+		if errs[0] != nil || errs[1] != errFull || errs[2] == nil || errs[2].Error() != "func" {
+			t.Fatalf("\t%s\tShould return the queued returns, then PublishFunc : %v", failed, errs)
+		}
+		t.Logf("\t%s\tShould return the queued returns, then PublishFunc.", succeed)
+
+		if !m.AssertPublishCalled(t, 3) || !m.AssertSubscribeCalled(t, 1) {
+			t.Fatalf("\t%s\tShould count the calls.", failed)
+		}
+		t.Logf("\t%s\tShould count the calls.", succeed)
+
+		if !m.AssertPublishCalledWith(t, "orders", 2) {
+			t.Fatalf("\t%s\tShould find the call with its arguments.", failed)
+		}
+		t.Logf("\t%s\tShould find the call with its arguments.", succeed)
+
+		if calls := m.PublishCalls(); calls[2].Key != "orders" || calls[2].V != 3 {
+			t.Fatalf("\t%s\tShould record the arguments in order : %+v", failed, calls)
+		}
+		t.Logf("\t%s\tShould record the arguments in order.", succeed)
+	}
+}
+
+// TestGenerated validates publisher_mock_test.go is what the generator writes today.
+func TestGenerated(t *testing.T) {
+	src, err := mockgen.Generate(mockgen.Config{
+		Interface: "publisher",
+		Files:     []string{"mockgen_test.go"},
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould generate the mock : %v", failed, err)
+	}
+
+	have, err := ioutil.ReadFile("publisher_mock_test.go")
+	if err != nil {
+		t.Fatalf("\t%s\tShould read the generated file : %v", failed, err)
+	}
+
+	if !bytes.Equal(src, have) {
+		t.Fatalf("\t%s\tShould be up to date, run go generate.", failed)
+	}
+	t.Logf("\t%s\tShould be up to date.", succeed)
+}
+
+// TestGenerate validates the mock of a harder interface type checks and implements it.
+func TestGenerate(t *testing.T) {
+	src, err := mockgen.Generate(mockgen.Config{
+		Interface: "Store",
+		Files:     []string{"testdata/store.go"},
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould generate the mock : %v", failed, err)
+	}
+	t.Logf("\t%s\tShould generate the mock.", succeed)
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, src := range map[string]interface{}{"testdata/store.go": nil, "mock.go": src} {
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatalf("\t%s\tShould parse %s : %v", failed, name, err)
+		}
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("store", fset, files, nil)
+	if err != nil {
+		t.Fatalf("\t%s\tShould type check : %v\n%s", failed, err, src)
+	}
+	t.Logf("\t%s\tShould type check.", succeed)
+
+	iface := pkg.Scope().Lookup("Store").Type().Underlying().(*types.Interface)
+	mock := types.NewPointer(pkg.Scope().Lookup("StoreMock").Type())
+	if !types.Implements(mock, iface) {
+		t.Fatalf("\t%s\tShould implement Store.", failed)
+	}
+	t.Logf("\t%s\tShould implement Store.", succeed)
+}
@@ -0,0 +1,185 @@
+// Code generated by mockgen; DO NOT EDIT.
+
+package mockgen_test
+
+import (
+	"reflect"
+	"sync"
+)
+
+// publisherMock is a mock of the publisher interface. The zero value is ready to use and it is
+// safe for concurrent use.
+type publisherMock struct {
+	mu sync.Mutex
+
+	// PublishFunc runs for the calls to Publish that have no queued return.
+	PublishFunc    func(key string, v interface{}) error
+	callsPublish   []publisherMockPublishCall
+	returnsPublish []publisherMockPublishReturn
+
+	// SubscribeFunc runs for the calls to Subscribe that have no queued return.
+	SubscribeFunc    func(key string) error
+	callsSubscribe   []publisherMockSubscribeCall
+	returnsSubscribe []publisherMockSubscribeReturn
+}
+
+// publisherMockPublishCall records the arguments of one call to Publish.
+type publisherMockPublishCall struct {
+	Key string
+	V   interface{}
+}
+
+// publisherMockPublishReturn is what one call to Publish returns.
+type publisherMockPublishReturn struct {
+	R0 error
+}
+
+// Publish implements the publisher interface. It records the call and returns the next
+// queued return, or what PublishFunc returns.
+func (m *publisherMock) Publish(key string, v interface{}) error {
+	m.mu.Lock()
+	m.callsPublish = append(m.callsPublish, publisherMockPublishCall{key, v})
+	var r publisherMockPublishReturn
+	queued := len(m.returnsPublish) > 0
+	if queued {
+		r = m.returnsPublish[0]
+		m.returnsPublish = m.returnsPublish[1:]
+	}
+	fn := m.PublishFunc
+	m.mu.Unlock()
+
+	if !queued && fn != nil {
+		return fn(key, v)
+	}
+	return r.R0
+}
+
+// PublishReturns queues what the next call to Publish returns. Call it once for every call to
+// stub, in order.
+func (m *publisherMock) PublishReturns(r0 error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.returnsPublish = append(m.returnsPublish, publisherMockPublishReturn{r0})
+}
+
+// PublishCalls returns the recorded calls to Publish.
+func (m *publisherMock) PublishCalls() []publisherMockPublishCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]publisherMockPublishCall(nil), m.callsPublish...)
+}
+
+// AssertPublishCalled fails the test unless Publish was called n times.
+func (m *publisherMock) AssertPublishCalled(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, n int) bool {
+	t.Helper()
+
+	if got := len(m.PublishCalls()); got != n {
+		t.Errorf("publisherMock.Publish called %d times, want %d", got, n)
+		return false
+	}
+	return true
+}
+
+// AssertPublishCalledWith fails the test unless one call to Publish had these
+// arguments. They are compared with reflect.DeepEqual.
+func (m *publisherMock) AssertPublishCalledWith(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, key string, v interface{}) bool {
+	t.Helper()
+
+	want := publisherMockPublishCall{key, v}
+	for _, call := range m.PublishCalls() {
+		if reflect.DeepEqual(call, want) {
+			return true
+		}
+	}
+
+	t.Errorf("publisherMock.Publish never called with %+v", want)
+	return false
+}
+
+// publisherMockSubscribeCall records the arguments of one call to Subscribe.
+type publisherMockSubscribeCall struct {
+	Key string
+}
+
+// publisherMockSubscribeReturn is what one call to Subscribe returns.
+type publisherMockSubscribeReturn struct {
+	R0 error
+}
+
+// Subscribe implements the publisher interface. It records the call and returns the next
+// queued return, or what SubscribeFunc returns.
+func (m *publisherMock) Subscribe(key string) error {
+	m.mu.Lock()
+	m.callsSubscribe = append(m.callsSubscribe, publisherMockSubscribeCall{key})
+	var r publisherMockSubscribeReturn
+	queued := len(m.returnsSubscribe) > 0
+	if queued {
+		r = m.returnsSubscribe[0]
+		m.returnsSubscribe = m.returnsSubscribe[1:]
+	}
+	fn := m.SubscribeFunc
+	m.mu.Unlock()
+
+	if !queued && fn != nil {
+		return fn(key)
+	}
+	return r.R0
+}
+
+// SubscribeReturns queues what the next call to Subscribe returns. Call it once for every call to
+// stub, in order.
+func (m *publisherMock) SubscribeReturns(r0 error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.returnsSubscribe = append(m.returnsSubscribe, publisherMockSubscribeReturn{r0})
+}
+
+// SubscribeCalls returns the recorded calls to Subscribe.
+func (m *publisherMock) SubscribeCalls() []publisherMockSubscribeCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]publisherMockSubscribeCall(nil), m.callsSubscribe...)
+}
+
+// AssertSubscribeCalled fails the test unless Subscribe was called n times.
+func (m *publisherMock) AssertSubscribeCalled(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, n int) bool {
+	t.Helper()
+
+	if got := len(m.SubscribeCalls()); got != n {
+		t.Errorf("publisherMock.Subscribe called %d times, want %d", got, n)
+		return false
+	}
+	return true
+}
+
+// AssertSubscribeCalledWith fails the test unless one call to Subscribe had these
+// arguments. They are compared with reflect.DeepEqual.
+func (m *publisherMock) AssertSubscribeCalledWith(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, key string) bool {
+	t.Helper()
+
+	want := publisherMockSubscribeCall{key}
+	for _, call := range m.SubscribeCalls() {
+		if reflect.DeepEqual(call, want) {
+			return true
+		}
+	}
+
+	t.Errorf("publisherMock.Subscribe never called with %+v", want)
+	return false
+}
@@ -0,0 +1,174 @@
+package mockgen
+
+import (
+	"strings"
+	"text/template"
+)
+
+// mockTmpl writes the mock. The output is run through gofmt, so the layout here only has to be
+// close.
+var mockTmpl = template.Must(template.New("mock").Funcs(template.FuncMap{
+	"exported": exported,
+	"params": func(fs []field, variadic bool) string {
+		parts := make([]string, len(fs))
+		for i, f := range fs {
+			typ := f.Type
+			if variadic && i == len(fs)-1 {
+				typ = "..." + strings.TrimPrefix(typ, "[]")
+			}
+			parts[i] = f.Name + " " + typ
+		}
+		return strings.Join(parts, ", ")
+	},
+	"args": func(fs []field, variadic bool) string {
+		parts := make([]string, len(fs))
+		for i, f := range fs {
+			parts[i] = f.Name
+			if variadic && i == len(fs)-1 {
+				parts[i] += "..."
+			}
+		}
+		return strings.Join(parts, ", ")
+	},
+	"results": func(fs []field) string {
+		parts := make([]string, len(fs))
+		for i, f := range fs {
+			parts[i] = f.Type
+		}
+		if len(parts) > 1 {
+			return "(" + strings.Join(parts, ", ") + ")"
+		}
+		return strings.Join(parts, ", ")
+	},
+	"returns": func(fs []field) string {
+		parts := make([]string, len(fs))
+		for i, f := range fs {
+			parts[i] = "r." + f.Field
+		}
+		return strings.Join(parts, ", ")
+	},
+}).Parse(`// Code generated by mockgen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+
+{{$mock := .Mock}}
+// {{$mock}} is a mock of the {{.Interface}} interface. The zero value is ready to use and it is
+// safe for concurrent use.
+type {{$mock}} struct {
+	mu sync.Mutex
+{{range .Methods}}
+	// {{.Name}}Func runs for the calls to {{.Name}} that have no queued return.
+	{{.Name}}Func func({{params .Params .Variadic}}) {{results .Results}}
+	calls{{.Name}} []{{$mock}}{{.Name}}Call
+{{- if .Results}}
+	returns{{.Name}} []{{$mock}}{{.Name}}Return
+{{- end}}
+{{end}}
+}
+
+{{range .Methods}}
+// {{$mock}}{{.Name}}Call records the arguments of one call to {{.Name}}.
+type {{$mock}}{{.Name}}Call struct {
+{{- range .Params}}
+	{{.Field}} {{.Type}}
+{{- end}}
+}
+
+{{if .Results}}
+// {{$mock}}{{.Name}}Return is what one call to {{.Name}} returns.
+type {{$mock}}{{.Name}}Return struct {
+{{- range .Results}}
+	{{.Field}} {{.Type}}
+{{- end}}
+}
+{{end}}
+
+// {{.Name}} implements the {{$.Interface}} interface. It records the call and returns the next
+// queued return, or what {{.Name}}Func returns.
+func (m *{{$mock}}) {{.Name}}({{params .Params .Variadic}}) {{results .Results}} {
+	m.mu.Lock()
+	m.calls{{.Name}} = append(m.calls{{.Name}}, {{$mock}}{{.Name}}Call{ {{- args .Params false -}} })
+{{- if .Results}}
+	var r {{$mock}}{{.Name}}Return
+	queued := len(m.returns{{.Name}}) > 0
+	if queued {
+		r = m.returns{{.Name}}[0]
+		m.returns{{.Name}} = m.returns{{.Name}}[1:]
+	}
+{{- end}}
+	fn := m.{{.Name}}Func
+	m.mu.Unlock()
+
+{{if .Results}}
+	if !queued && fn != nil {
+		return fn({{args .Params .Variadic}})
+	}
+	return {{returns .Results}}
+{{- else}}
+	if fn != nil {
+		fn({{args .Params .Variadic}})
+	}
+{{- end}}
+}
+
+{{if .Results}}
+// {{.Name}}Returns queues what the next call to {{.Name}} returns. Call it once for every call to
+// stub, in order.
+func (m *{{$mock}}) {{.Name}}Returns({{range $i, $r := .Results}}{{if $i}}, {{end}}r{{$i}} {{$r.Type}}{{end}}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.returns{{.Name}} = append(m.returns{{.Name}}, {{$mock}}{{.Name}}Return{ {{- range $i, $r := .Results}}{{if $i}}, {{end}}r{{$i}}{{end -}} })
+}
+{{end}}
+
+// {{.Name}}Calls returns the recorded calls to {{.Name}}.
+func (m *{{$mock}}) {{.Name}}Calls() []{{$mock}}{{.Name}}Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]{{$mock}}{{.Name}}Call(nil), m.calls{{.Name}}...)
+}
+
+// Assert{{exported .Name}}Called fails the test unless {{.Name}} was called n times.
+func (m *{{$mock}}) Assert{{exported .Name}}Called(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, n int) bool {
+	t.Helper()
+
+	if got := len(m.{{.Name}}Calls()); got != n {
+		t.Errorf("{{$mock}}.{{.Name}} called %d times, want %d", got, n)
+		return false
+	}
+	return true
+}
+
+{{if .Params}}
+// Assert{{exported .Name}}CalledWith fails the test unless one call to {{.Name}} had these
+// arguments. They are compared with reflect.DeepEqual.
+func (m *{{$mock}}) Assert{{exported .Name}}CalledWith(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}, {{params .Params false}}) bool {
+	t.Helper()
+
+	want := {{$mock}}{{.Name}}Call{ {{- args .Params false -}} }
+	for _, call := range m.{{.Name}}Calls() {
+		if reflect.DeepEqual(call, want) {
+			return true
+		}
+	}
+
+	t.Errorf("{{$mock}}.{{.Name}} never called with %+v", want)
+	return false
+}
+{{end}}
+{{end}}
+`))
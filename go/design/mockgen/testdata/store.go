@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	stdio "io"
+)
+
+type closer interface {
+	Close() error
+}
+
+// Store has embedded interfaces, variadic and unnamed parameters, several results and
+// parameters named like the variables, packages and builtins the generated code uses.
+type Store interface {
+	closer
+	error
+	Get(ctx context.Context, m string) ([]byte, bool, error)
+	Put(context.Context, string, ...[]byte) (n int, err error)
+	Copy(w stdio.Writer, keys ...string)
+	Len() int
+	Find(want string, arg0, reflect int, call bool, sync, len, append []int, true, fn, queued, r, t error) error
+}
@@ -30,40 +30,46 @@
 // their application.
 
 // Package pubsub simulates a package that provides publication/subscription type services.
+// The real thing lives in go/design/pubsub. It is built in the concrete too, with no interface.
 
 package main
 
 import (
-	"fmt"
+	"github.com/hoanhan101/ultimate-go/go/design/pubsub"
 )
 
+// broker routes the messages of every PubSub in this program.
+var broker = pubsub.NewBroker()
+
 // PubSub provides access to a queue system.
 type PubSub struct {
 	host string
-	// PRETEND THERE ARE MORE FIELDS.
+	ps   *pubsub.PubSub
 }
 
 // New creates a pubsub value for use.
+// Every value shares the in-process broker. To talk to a pubsub.Server at host instead,
+// pubsub.Dial(host, 0) returns a client with the same methods.
 func New(host string) *PubSub {
 	ps := PubSub{
 		host: host,
+		ps:   pubsub.New(broker, pubsub.Config{Buffer: 10, Policy: pubsub.DropOldest}),
 	}
 
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-
 	return &ps
 }
 
 // Publish sends the data to the specified key.
 func (ps *PubSub) Publish(key string, v interface{}) error {
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-	fmt.Println("Actual PubSub: Publish")
-	return nil
+	return ps.ps.Publish(key, v)
 }
 
 // Subscribe sets up an request to receive messages from the specified key.
 func (ps *PubSub) Subscribe(key string) error {
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-	fmt.Println("Actual PubSub: Subscribe")
-	return nil
+	return ps.ps.Subscribe(key)
+}
+
+// Messages returns the channel messages from the subscribed keys are received on.
+func (ps *PubSub) Messages() <-chan pubsub.Message {
+	return ps.ps.Messages()
 }
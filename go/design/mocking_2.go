@@ -22,6 +22,9 @@ type publisher interface {
 }
 
 // mock is a concrete type to help support the mocking of the pubsub package.
+// Writing this by hand for every interface gets old. go/design/mockgen writes a mock that records
+// calls, stubs returns per call and has assertions for tests.
+// Run: `go run ./go/design/mockgen/cmd/mockgen -i publisher ./go/design/mocking_2.go`
 type mock struct{}
 
 // Publish implements the publisher interface for the mock.
@@ -50,7 +53,11 @@ func main() {
 	// the level of decoupling the user needs. The pubsub package did not need
 	// to provide the interface type.
 	for _, p := range pubs {
-		p.Publish("key", "value")
 		p.Subscribe("key")
+		p.Publish("key", "value")
 	}
+
+	// The actual PubSub really delivered the message. Only the concrete type knows how to read it.
+	m := <-pubs[0].(*PubSub).Messages()
+	fmt.Printf("Actual PubSub: %s = %v\n", m.Key, m.Value)
 }
@@ -6,45 +6,81 @@
 
 package main
 
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hoanhan101/ultimate-go/go/design/tcp"
+)
+
 // Server implementation.
+// The real work is done by go/design/tcp, which has the same concrete API.
 type Server struct {
 	host string
-	// PRETEND THERE ARE MORE FIELDS.
+	srv  *tcp.Server
 }
 
 // NewServer returns just a concrete pointer of type Server
 func NewServer(host string) *Server {
-	return &Server{host}
+	return &Server{
+		host: host,
+		srv:  tcp.NewServer(host, tcp.HandlerFunc(shout)),
+	}
 }
 
 // Start allows the server to begin to accept requests.
 func (s *Server) Start() error {
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-	return nil
+	return s.srv.Start()
 }
 
-// Stop shuts the server down.
+// Stop shuts the server down. It stops accepting connections and lets the ones in progress finish.
 func (s *Server) Stop() error {
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-	return nil
+	return s.srv.Stop()
 }
 
-// Wait prevents the server from accepting new connections.
+// Wait blocks until the server is stopped and every connection is done.
 func (s *Server) Wait() error {
-	// PRETEND THERE IS A SPECIFIC IMPLEMENTATION.
-	return nil
+	return s.srv.Wait()
+}
+
+// shout answers every line in upper case.
+func shout(ctx context.Context, c net.Conn) {
+	sc := bufio.NewScanner(c)
+	for sc.Scan() {
+		fmt.Fprintln(c, strings.ToUpper(sc.Text()))
+	}
 }
 
 func main() {
-	// Create a new Server.
-	srv := NewServer("localhost")
+	// Create a new Server. Port 0 picks any free port.
+	srv := NewServer("localhost:0")
 
 	// Use the APIs.
-	srv.Start()
+	if err := srv.Start(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	c, err := net.Dial("tcp", srv.srv.Addr().String())
+	if err == nil {
+		fmt.Fprintln(c, "hello")
+		line, _ := bufio.NewReader(c).ReadString('\n')
+		fmt.Print(line)
+		c.Close()
+	}
+
 	srv.Stop()
 	srv.Wait()
 }
 
+// A program usually runs more than one of these. go/design/lifecycle has a Supervisor that starts
+// them in dependency order and stops them in reverse on a signal or on the first failure. That is
+// where an interface belongs: the supervisor has many implementations to run, so it declares the
+// Component interface it needs and *Server satisfies it without knowing.
+
 // Guidelines around interface pollution:
 // --------------------------------------
 // Use an interface:
@@ -0,0 +1,390 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is returned by Publish while the client is reconnecting, or when the connection
+// was lost before the server replied.
+var ErrDisconnected = errors.New("pubsub: disconnected")
+
+// ServerError is returned when the server rejected a command with an ERR reply.
+type ServerError struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ServerError) Error() string {
+	return "pubsub: server: " + e.Reason
+}
+
+// Is lets errors.Is match the error variables of this package the server replied with, like
+// ErrInvalidKey for a key that can't be published to.
+func (e *ServerError) Is(target error) bool {
+	switch target {
+	case ErrInvalidKey, ErrClosed, ErrNotDurable:
+		return e.Reason == target.Error()
+	}
+
+	return false
+}
+
+// Client is a PubSub connected to a Server. It has the same Publish and Subscribe methods, so it
+// satisfies the publisher interface in mocking_2.go as well.
+//
+// Publish, Subscribe and Unsubscribe wait for the server to accept the command, and return a
+// *ServerError when it didn't. The reply comes after the messages received before it, so keep
+// reading Messages from another Goroutine while calling them. When the connection is lost, the client dials again with a backoff
+// and subscribes to its keys again. Messages published while it was away are lost. Values are
+// received as json.RawMessage, decode them into the type you expect.
+type Client struct {
+	addr      string
+	heartbeat time.Duration
+
+	mu      sync.Mutex
+	c       net.Conn
+	w       *bufio.Writer
+	keys    map[string]struct{}
+	pending []chan error // commands waiting for their reply, in the order they were sent
+	closed  bool
+
+	ch   chan Message
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Dial connects to the Server at addr. A heartbeat of 0 uses DefaultHeartbeat.
+func Dial(addr string, heartbeat time.Duration) (*Client, error) {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cl := Client{
+		addr:      addr,
+		heartbeat: heartbeat,
+		c:         c,
+		w:         bufio.NewWriter(c),
+		keys:      make(map[string]struct{}),
+		ch:        make(chan Message, 64),
+		done:      make(chan struct{}),
+	}
+
+	cl.wg.Add(2)
+	go cl.read(c)
+	go cl.ping()
+
+	return &cl, nil
+}
+
+// Publish sends the data to the specified key. The value is encoded as JSON.
+func (cl *Client) Publish(key string, v interface{}) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return cl.request("PUB %s %s", key, data)
+}
+
+// Subscribe sets up a request to receive messages from the specified key on the Messages channel.
+// The key is remembered, so it survives a reconnect.
+func (cl *Client) Subscribe(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	cl.mu.Lock()
+	if cl.closed {
+		cl.mu.Unlock()
+		return ErrClosed
+	}
+	cl.keys[key] = struct{}{}
+	cl.mu.Unlock()
+
+	// While disconnected the key is sent on reconnect.
+	err := cl.request("SUB %s", key)
+	if err == ErrDisconnected {
+		return nil
+	}
+
+	// The server will never accept it, don't send it again on reconnect.
+	if _, ok := err.(*ServerError); ok {
+		cl.mu.Lock()
+		delete(cl.keys, key)
+		cl.mu.Unlock()
+	}
+
+	return err
+}
+
+// Unsubscribe stops messages from the specified key.
+func (cl *Client) Unsubscribe(key string) error {
+	cl.mu.Lock()
+	if cl.closed {
+		cl.mu.Unlock()
+		return ErrClosed
+	}
+	delete(cl.keys, key)
+	cl.mu.Unlock()
+
+	if err := cl.request("UNSUB %s", key); err != ErrDisconnected {
+		return err
+	}
+	return nil
+}
+
+// Messages returns the channel messages are received on. It is closed by Close.
+func (cl *Client) Messages() <-chan Message {
+	return cl.ch
+}
+
+// Close closes the connection and the Messages channel. It stops reconnecting.
+func (cl *Client) Close() error {
+	cl.mu.Lock()
+	if cl.closed {
+		cl.mu.Unlock()
+		return nil
+	}
+	cl.closed = true
+	close(cl.done)
+
+	var err error
+	if cl.c != nil {
+		cl.w.Flush()
+		err = cl.c.Close()
+	}
+	cl.mu.Unlock()
+
+	cl.wg.Wait()
+	close(cl.ch)
+
+	return err
+}
+
+// send writes one line on the current connection.
+func (cl *Client) send(format string, args ...interface{}) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	switch {
+	case cl.closed:
+		return ErrClosed
+	case cl.c == nil:
+		return ErrDisconnected
+	}
+
+	return cl.writeLocked(format, args...)
+}
+
+// request sends one command and waits for the server to reply to it.
+func (cl *Client) request(format string, args ...interface{}) error {
+	cl.mu.Lock()
+
+	switch {
+	case cl.closed:
+		cl.mu.Unlock()
+		return ErrClosed
+	case cl.c == nil:
+		cl.mu.Unlock()
+		return ErrDisconnected
+	}
+
+	if err := cl.writeLocked(format, args...); err != nil {
+		cl.mu.Unlock()
+		return err
+	}
+
+	// Added under the same lock as the write, so pending is in the order the server replies in.
+	reply := make(chan error, 1)
+	cl.pending = append(cl.pending, reply)
+	cl.mu.Unlock()
+
+	select {
+	case err := <-reply:
+		return err
+	case <-cl.done:
+		return ErrClosed
+	}
+}
+
+// replied hands the reply of the server to the oldest command waiting for one.
+func (cl *Client) replied(err error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if len(cl.pending) == 0 {
+		return
+	}
+
+	reply := cl.pending[0]
+	cl.pending = cl.pending[1:]
+
+	// The commands sent again on reconnect have nobody waiting.
+	if reply != nil {
+		reply <- err
+	}
+}
+
+// writeLocked writes one line and flushes it. The caller holds mu.
+func (cl *Client) writeLocked(format string, args ...interface{}) error {
+	cl.c.SetWriteDeadline(time.Now().Add(2 * cl.heartbeat))
+
+	fmt.Fprintf(cl.w, format, args...)
+	cl.w.WriteByte('\n')
+	return cl.w.Flush()
+}
+
+// ping sends the heartbeat until Close.
+func (cl *Client) ping() {
+	defer cl.wg.Done()
+
+	t := time.NewTicker(cl.heartbeat)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			cl.send("PING")
+		case <-cl.done:
+			return
+		}
+	}
+}
+
+// read receives the messages from c. When c fails it reconnects and carries on with the new
+// connection, until Close.
+func (cl *Client) read(c net.Conn) {
+	defer cl.wg.Done()
+
+	for {
+		cl.receive(c)
+
+		cl.mu.Lock()
+		if cl.closed {
+			cl.mu.Unlock()
+			return
+		}
+		cl.c.Close()
+		cl.c = nil
+
+		// The replies to these commands were lost with the connection.
+		for _, reply := range cl.pending {
+			if reply != nil {
+				reply <- ErrDisconnected
+			}
+		}
+		cl.pending = nil
+		cl.mu.Unlock()
+
+		if c = cl.reconnect(); c == nil {
+			return
+		}
+	}
+}
+
+// receive reads lines from c until it fails or is quiet for longer than two heartbeats.
+func (cl *Client) receive(c net.Conn) {
+	sc := bufio.NewScanner(c)
+	sc.Buffer(make([]byte, 4096), maxLine)
+
+	for {
+		c.SetReadDeadline(time.Now().Add(2 * cl.heartbeat))
+		if !sc.Scan() {
+			return
+		}
+
+		line := sc.Bytes()
+		switch {
+		case string(line) == "OK":
+			cl.replied(nil)
+			continue
+
+		case bytes.HasPrefix(line, []byte("ERR ")):
+			cl.replied(&ServerError{Reason: string(line[len("ERR "):])})
+			continue
+		}
+
+		parts := bytes.SplitN(line, []byte(" "), 3)
+		if string(parts[0]) != "MSG" || len(parts) != 3 {
+			// PONG only proves the connection is alive, the deadline is already moved.
+			continue
+		}
+
+		v := make(json.RawMessage, len(parts[2]))
+		copy(v, parts[2])
+
+		select {
+		case cl.ch <- Message{Key: string(parts[1]), Value: v}:
+		case <-cl.done:
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds or Close is called, then subscribes to every key again.
+// It returns nil after Close.
+func (cl *Client) reconnect() net.Conn {
+	wait := 100 * time.Millisecond
+
+	for {
+		select {
+		case <-time.After(wait):
+		case <-cl.done:
+			return nil
+		}
+
+		if wait *= 2; wait > 5*time.Second {
+			wait = 5 * time.Second
+		}
+
+		c, err := net.Dial("tcp", cl.addr)
+		if err != nil {
+			continue
+		}
+
+		cl.mu.Lock()
+		if cl.closed {
+			cl.mu.Unlock()
+			c.Close()
+			return nil
+		}
+
+		cl.c = c
+		cl.w = bufio.NewWriter(c)
+
+		err = nil
+		for key := range cl.keys {
+			if err = cl.writeLocked("SUB %s", key); err != nil {
+				break
+			}
+			cl.pending = append(cl.pending, nil)
+		}
+
+		if err != nil {
+			cl.c = nil
+			cl.pending = nil
+			cl.mu.Unlock()
+			c.Close()
+			continue
+		}
+		cl.mu.Unlock()
+
+		return c
+	}
+}
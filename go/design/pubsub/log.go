@@ -0,0 +1,403 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log is an append-only log of messages stored on disk in segments. Every message gets the next
+// offset, starting at 0. A segment is a file named after the offset of its first message, like
+// 00000000000000000042.log, holding records of:
+//
+//	4 bytes   length of the value
+//	8 bytes   time of the append in Unix nanoseconds
+//	n bytes   value
+//
+// The log starts a new segment when the current one reaches SegmentSize. Retention removes whole
+// segments, oldest first, and never the one being written to. It runs on every Append and, when
+// MaxAge is set, on a timer so a topic nobody writes to still expires.
+type Log struct {
+	cfg LogConfig
+
+	mu       sync.Mutex
+	segments []*segment
+	file     *os.File // last segment, opened for append
+	next     int64    // offset of the next message
+
+	done chan struct{} // closed by Close to stop the retention timer
+}
+
+// LogConfig describes where a log lives and how much of it is kept.
+type LogConfig struct {
+	Dir         string        // Directory of the segments, created if it does not exist.
+	SegmentSize int64         // Size a segment is rolled at. 1MB when 0.
+	MaxBytes    int64         // Segments are removed while the log is bigger. 0 keeps everything.
+	MaxAge      time.Duration // Segments with only older messages are removed. 0 keeps everything.
+}
+
+// segment is one file of the log.
+type segment struct {
+	base  int64 // offset of the first message
+	count int64
+	size  int64
+	last  time.Time // time of the newest message
+	path  string
+}
+
+// headerSize is the size of the record header.
+const headerSize = 12
+
+// ErrCorrupt is returned when a segment can't be read back.
+var ErrCorrupt = errors.New("pubsub: corrupt log segment")
+
+// OpenLog opens the log in cfg.Dir, creating it if needed. A record cut short by a crash at the
+// end of the last segment is removed.
+func OpenLog(cfg LogConfig) (*Log, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = 1 << 20
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := Log{cfg: cfg}
+	for _, fi := range infos {
+		name := fi.Name()
+		if !strings.HasSuffix(name, ".log") {
+			continue
+		}
+
+		base, err := strconv.ParseInt(strings.TrimSuffix(name, ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s := segment{base: base, path: filepath.Join(cfg.Dir, name)}
+		if err := s.scan(); err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, &s)
+	}
+
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].base < l.segments[j].base
+	})
+
+	if n := len(l.segments); n > 0 {
+		last := l.segments[n-1]
+		l.next = last.base + last.count
+
+		if err := os.Truncate(last.path, last.size); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.roll(); err != nil {
+		return nil, err
+	}
+
+	l.retain(time.Now())
+
+	if cfg.MaxAge > 0 {
+		l.done = make(chan struct{})
+		go l.expire(l.done)
+	}
+
+	return &l, nil
+}
+
+// expire runs retention every half of MaxAge until the log is closed, so a segment outlives
+// MaxAge by half of it at most.
+func (l *Log) expire(done <-chan struct{}) {
+	every := l.cfg.MaxAge / 2
+	if every < time.Millisecond {
+		every = time.Millisecond
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			l.mu.Lock()
+			l.retain(now)
+			l.mu.Unlock()
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// scan reads the segment to count its messages. It stops at the first record that is cut short.
+func (s *segment) scan() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		t, v, err := readRecord(r, fi.Size()-s.size)
+		if err != nil {
+			// The end of the file, or a record cut short by a crash.
+			return nil
+		}
+
+		s.count++
+		s.size += headerSize + int64(len(v))
+		s.last = t
+	}
+}
+
+// roll opens the segment to append to, starting a new one when there is none or the last one is
+// full. The caller holds mu or is OpenLog.
+func (l *Log) roll() error {
+	n := len(l.segments)
+	if n > 0 && l.segments[n-1].size < l.cfg.SegmentSize {
+		if l.file != nil {
+			return nil
+		}
+
+		f, err := os.OpenFile(l.segments[n-1].path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		l.file = f
+		return nil
+	}
+
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+
+	s := segment{
+		base: l.next,
+		path: filepath.Join(l.cfg.Dir, fmt.Sprintf("%020d.log", l.next)),
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	l.file = f
+	l.segments = append(l.segments, &s)
+	return nil
+}
+
+// Append writes v at the end of the log and returns its offset.
+func (l *Log) Append(v []byte) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return 0, ErrClosed
+	}
+
+	now := time.Now()
+
+	// One write per record, so a reader never sees half of one before Append returns.
+	rec := make([]byte, headerSize+len(v))
+	binary.BigEndian.PutUint32(rec, uint32(len(v)))
+	binary.BigEndian.PutUint64(rec[4:], uint64(now.UnixNano()))
+	copy(rec[headerSize:], v)
+
+	if _, err := l.file.Write(rec); err != nil {
+		return 0, err
+	}
+
+	s := l.segments[len(l.segments)-1]
+	s.count++
+	s.size += int64(len(rec))
+	s.last = now
+
+	off := l.next
+	l.next++
+
+	if err := l.roll(); err != nil {
+		return off, err
+	}
+	l.retain(now)
+
+	return off, nil
+}
+
+// retain removes the oldest segments while the log is over MaxBytes or they are older than
+// MaxAge. The caller holds mu.
+func (l *Log) retain(now time.Time) {
+	var total int64
+	for _, s := range l.segments {
+		total += s.size
+	}
+
+	for len(l.segments) > 1 {
+		s := l.segments[0]
+
+		tooBig := l.cfg.MaxBytes > 0 && total > l.cfg.MaxBytes
+		tooOld := l.cfg.MaxAge > 0 && now.Sub(s.last) > l.cfg.MaxAge
+		if !tooBig && !tooOld {
+			return
+		}
+
+		// A reader that has the file open can finish reading it.
+		os.Remove(s.path)
+		total -= s.size
+		l.segments = l.segments[1:]
+	}
+}
+
+// Earliest returns the offset of the oldest message still in the log.
+func (l *Log) Earliest() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.segments[0].base
+}
+
+// Next returns the offset the next message appended will get.
+func (l *Log) Next() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.next
+}
+
+// Read calls fn for every message from offset from up to, not including, to. Offsets that were
+// removed by retention are skipped, even when retention removes them during the Read. Reading
+// stops at the first error fn returns.
+func (l *Log) Read(from, to int64, fn func(off int64, t time.Time, v []byte) error) error {
+	for from < to {
+		s, f, err := l.open(from, to)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			return nil
+		}
+
+		err = s.read(f, from, to, fn)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		from = s.base + s.count
+	}
+
+	return nil
+}
+
+// open returns the first segment with messages between from and to, and the segment file opened
+// for reading. The file is opened holding mu, so retention can't remove it before: once open, it
+// can be read to the end even if retention removes it. A segment whose file is missing is skipped.
+// The file is nil when there is no segment left.
+func (l *Log) open(from, to int64) (segment, *os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.segments {
+		if s.base+s.count <= from || s.base >= to {
+			continue
+		}
+
+		f, err := os.Open(s.path)
+		switch {
+		case os.IsNotExist(err):
+			// Removed behind our back, skip it like retention would have.
+			continue
+		case err != nil:
+			return segment{}, nil, err
+		}
+
+		return *s, f, nil
+	}
+
+	return segment{}, nil, nil
+}
+
+// read calls fn for the messages of the segment between from and to, reading them from f.
+func (s segment) read(f io.Reader, from, to int64, fn func(off int64, t time.Time, v []byte) error) error {
+	r := bufio.NewReader(f)
+	for off := s.base; off < s.base+s.count && off < to; off++ {
+		t, v, err := readRecord(r, s.size)
+		if err != nil {
+			return ErrCorrupt
+		}
+
+		if off < from {
+			continue
+		}
+
+		if err := fn(off, t, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRecord reads one record. max is how many bytes are left to read, a header claiming more than
+// that is corrupt and we don't allocate what it asks for.
+func readRecord(r io.Reader, max int64) (time.Time, []byte, error) {
+	var h [headerSize]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(h[:]))
+	if n > max-headerSize {
+		return time.Time{}, nil, ErrCorrupt
+	}
+
+	v := make([]byte, n)
+	if _, err := io.ReadFull(r, v); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(h[4:]))), v, nil
+}
+
+// Close closes the segment being written to and stops the retention timer.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done != nil {
+		close(l.done)
+		l.done = nil
+	}
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
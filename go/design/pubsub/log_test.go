@@ -0,0 +1,276 @@
+package pubsub_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/pubsub"
+)
+
+// readAll returns the values in the log from offset from.
+func readAll(t *testing.T, l *pubsub.Log, from int64) []string {
+	var vs []string
+	err := l.Read(from, l.Next(), func(off int64, _ time.Time, v []byte) error {
+		vs = append(vs, strconv.FormatInt(off, 10)+"="+string(v))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould read the log : %v", failed, err)
+	}
+
+	return vs
+}
+
+// TestLog validates messages survive a restart and retention removes the oldest segments.
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Log("Given the need to keep messages on disk.")
+	{
+		t.Logf("\tTest 0:\tWhen appending across segments and opening the log again.")
+		{
+			// Every record is 13 bytes, so a segment holds 2 of them.
+			l, err := pubsub.OpenLog(pubsub.LogConfig{Dir: dir, SegmentSize: 20})
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the log : %v", failed, err)
+			}
+
+			for i := 0; i < 5; i++ {
+				l.Append([]byte(strconv.Itoa(i)))
+			}
+			l.Close()
+
+			l, err = pubsub.OpenLog(pubsub.LogConfig{Dir: dir, SegmentSize: 20})
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the log again : %v", failed, err)
+			}
+
+			if off, _ := l.Append([]byte("5")); off != 5 {
+				t.Fatalf("\t%s\tShould continue at offset 5 : %d", failed, off)
+			}
+			t.Logf("\t%s\tShould continue at offset 5.", succeed)
+
+			if vs := readAll(t, l, 3); len(vs) != 3 || vs[0] != "3=3" || vs[2] != "5=5" {
+				t.Fatalf("\t%s\tShould read from offset 3 : %v", failed, vs)
+			}
+			t.Logf("\t%s\tShould read from offset 3.", succeed)
+			l.Close()
+		}
+
+		t.Logf("\tTest 1:\tWhen the log is over its size.")
+		{
+			l, err := pubsub.OpenLog(pubsub.LogConfig{Dir: dir, SegmentSize: 20, MaxBytes: 40})
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the log : %v", failed, err)
+			}
+			defer l.Close()
+
+			if l.Earliest() != 4 {
+				t.Fatalf("\t%s\tShould keep the newest segments only : %d", failed, l.Earliest())
+			}
+			t.Logf("\t%s\tShould keep the newest segments only.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen the segments get old and nothing is appended.")
+		{
+			l, err := pubsub.OpenLog(pubsub.LogConfig{Dir: t.TempDir(), SegmentSize: 20, MaxAge: 50 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the log : %v", failed, err)
+			}
+			defer l.Close()
+
+			for i := 0; i < 3; i++ {
+				l.Append([]byte(strconv.Itoa(i)))
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for l.Earliest() != 2 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if l.Earliest() != 2 {
+				t.Fatalf("\t%s\tShould remove the old segment without an append : %d", failed, l.Earliest())
+			}
+			t.Logf("\t%s\tShould remove the old segment without an append.", succeed)
+		}
+
+		t.Logf("\tTest 3:\tWhen a record header claims more than the segment holds.")
+		{
+			dir := t.TempDir()
+			l, err := pubsub.OpenLog(pubsub.LogConfig{Dir: dir})
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the log : %v", failed, err)
+			}
+			defer l.Close()
+
+			l.Append([]byte("0"))
+
+			// Overwrite the length of the record with the largest one there is.
+			f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d.log", 0)), os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatalf("\t%s\tShould open the segment : %v", failed, err)
+			}
+			f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 0)
+			f.Close()
+
+			err = l.Read(0, l.Next(), func(int64, time.Time, []byte) error { return nil })
+			if err != pubsub.ErrCorrupt {
+				t.Fatalf("\t%s\tShould report the segment is corrupt : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould report the segment is corrupt.", succeed)
+		}
+	}
+}
+
+// TestDurable validates subscribers can replay a durable topic.
+func TestDurable(t *testing.T) {
+	dir := t.TempDir()
+
+	b := pubsub.NewBroker()
+	if err := b.Durable("orders", pubsub.LogConfig{Dir: dir}); err != nil {
+		t.Fatalf("\t%s\tShould make the topic durable : %v", failed, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		b.Publish("orders", i)
+	}
+
+	// next waits for the next message and returns it as offset=value.
+	next := func(ps *pubsub.PubSub) string {
+		select {
+		case m := <-ps.Messages():
+			return strconv.FormatInt(m.Offset, 10) + "=" + string(m.Value.(json.RawMessage))
+		case <-time.After(time.Second):
+			return "timeout"
+		}
+	}
+
+	t.Log("Given the need to receive messages published while away.")
+	{
+		t.Logf("\tTest 0:\tWhen subscribing from the earliest message.")
+		{
+			ps := pubsub.New(b, pubsub.Config{Buffer: 1})
+			defer ps.Close()
+
+			if err := ps.SubscribeFrom("orders", pubsub.Earliest); err != nil {
+				t.Fatalf("\t%s\tShould subscribe : %v", failed, err)
+			}
+
+			// The buffer is smaller than the replay, publishing now races with it.
+			go b.Publish("orders", 5)
+
+			for i := 0; i < 6; i++ {
+				want := strconv.Itoa(i) + "=" + strconv.Itoa(i)
+				if got := next(ps); got != want {
+					t.Fatalf("\t%s\tShould receive %s in order : %s", failed, want, got)
+				}
+			}
+			t.Logf("\t%s\tShould receive every message once and in order.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen subscribing from an offset after a restart.")
+		{
+			b.Close()
+
+			b = pubsub.NewBroker()
+			defer b.Close()
+			b.Durable("orders", pubsub.LogConfig{Dir: dir})
+
+			ps := pubsub.New(b, pubsub.Config{Buffer: 10})
+			ps.SubscribeFrom("orders", 4)
+
+			if got := next(ps); got != "4=4" {
+				t.Fatalf("\t%s\tShould start at offset 4 : %s", failed, got)
+			}
+			t.Logf("\t%s\tShould start at offset 4.", succeed)
+
+			if err := ps.SubscribeFrom("users", pubsub.Earliest); err != pubsub.ErrNotDurable {
+				t.Fatalf("\t%s\tShould not replay a topic that is not durable : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould not replay a topic that is not durable.", succeed)
+		}
+	}
+}
+
+// TestDurableRetention validates a replay skips what retention removes while it runs.
+func TestDurableRetention(t *testing.T) {
+	b := pubsub.NewBroker()
+	defer b.Close()
+
+	// Every record is 13 bytes, so a segment holds 2 of them and the log keeps about 3 segments.
+	cfg := pubsub.LogConfig{Dir: t.TempDir(), SegmentSize: 20, MaxBytes: 60}
+	if err := b.Durable("audit.eu", cfg); err != nil {
+		t.Fatalf("\t%s\tShould make the topic durable : %v", failed, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Publish("audit.eu", i)
+	}
+
+	// next waits for the next message.
+	next := func(ps *pubsub.PubSub) (pubsub.Message, bool) {
+		select {
+		case m, ok := <-ps.Messages():
+			return m, ok
+		case <-time.After(time.Second):
+			t.Fatalf("\t%s\tShould receive a message before the timeout.", failed)
+			return pubsub.Message{}, false
+		}
+	}
+
+	t.Log("Given the need to replay a durable topic while retention runs.")
+	{
+		t.Logf("\tTest 0:\tWhen the segments being replayed are removed.")
+		{
+			ps := pubsub.New(b, pubsub.Config{})
+			defer ps.Close()
+
+			all := pubsub.New(b, pubsub.Config{Buffer: 100})
+			defer all.Close()
+			all.Subscribe("audit.*")
+
+			ps.SubscribeFrom("audit.eu", pubsub.Earliest)
+
+			// The replay is blocked on the unbuffered channel, holding the first segment open.
+			m, _ := next(ps)
+			last := m.Offset
+
+			for i := 10; i < 30; i++ {
+				b.Publish("audit.eu", i)
+			}
+
+			for last != 29 {
+				m, ok := next(ps)
+				if !ok {
+					t.Fatalf("\t%s\tShould keep the subscriber open : %v", failed, ps.Err())
+				}
+
+				if m.Offset <= last {
+					t.Fatalf("\t%s\tShould receive the offsets in order : %d after %d", failed, m.Offset, last)
+				}
+				last = m.Offset
+
+				if _, ok := m.Value.(json.RawMessage); !ok {
+					t.Fatalf("\t%s\tShould replay a json.RawMessage : %T", failed, m.Value)
+				}
+			}
+			t.Logf("\t%s\tShould skip the removed offsets and keep the subscriber open.", succeed)
+
+			if ps.Err() != nil {
+				t.Fatalf("\t%s\tShould not report an error : %v", failed, ps.Err())
+			}
+			t.Logf("\t%s\tShould not report an error.", succeed)
+
+			m, _ = next(all)
+			if _, ok := m.Value.(json.RawMessage); !ok {
+				t.Fatalf("\t%s\tShould deliver a json.RawMessage to a wildcard subscriber : %T", failed, m.Value)
+			}
+			t.Logf("\t%s\tShould deliver a json.RawMessage to a wildcard subscriber.", succeed)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+// Package pubsub provides an in-process publication/subscription broker.
+//
+// This is the real version of the PubSub type in mocking_1.go. It is still built in the concrete:
+// a Broker routes messages by key and a PubSub is one subscriber connected to it. PubSub has the
+// Publish and Subscribe methods the publisher interface in mocking_2.go asks for, so an
+// application can keep substituting its own mock in tests.
+//
+// Every PubSub receives its messages on one channel. When the channel is full, the Policy decides
+// what happens: the publisher waits, the oldest message in the channel is dropped or the new
+// message is dropped.
+//
+// Keys are hierarchical, like orders.eu.created, and a subscription can match a family of keys with
+// the * and > wildcards.
+//
+// A topic is forgotten as soon as Publish returns, unless it was made durable. A durable topic
+// keeps its messages in a Log on disk, so a subscriber can start from the earliest message still
+// kept, the latest or any offset in between with SubscribeFrom.
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned when using a Broker or a PubSub that was closed.
+var ErrClosed = errors.New("pubsub: closed")
+
+// ErrInvalidKey is returned for a key that is empty, has an empty token or a misplaced wildcard.
+// Over the network, a key can't have white space either.
+var ErrInvalidKey = errors.New("pubsub: invalid key")
+
+// ErrNotDurable is returned by SubscribeFrom for a key that is not durable.
+var ErrNotDurable = errors.New("pubsub: topic is not durable")
+
+// Positions SubscribeFrom can start at, besides an offset.
+const (
+	Earliest int64 = -1 // The oldest message still in the log.
+	Latest   int64 = -2 // Only messages published from now on.
+)
+
+// Message is what a subscriber receives.
+type Message struct {
+	Key string
+
+	// Value is the value given to Publish. For a durable topic it is always a json.RawMessage,
+	// whether the message is replayed or live and whatever the subscription, a wildcard one too.
+	Value interface{}
+
+	// Offset is the position of the message in the log of a durable topic. It is 0 for the
+	// other topics.
+	Offset int64
+}
+
+// Policy decides what a publisher does when a subscriber's channel is full.
+type Policy int
+
+// Set of policies for slow subscribers.
+const (
+	// Block makes the publisher wait until the subscriber has room. Nothing is lost but one slow
+	// subscriber slows down every publisher of its keys.
+	Block Policy = iota
+
+	// DropOldest removes the oldest message in the channel to make room for the new one.
+	DropOldest
+
+	// DropNewest throws away the new message.
+	DropNewest
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	}
+
+	return "unknown"
+}
+
+// Config is how a subscriber wants its messages.
+type Config struct {
+	Buffer int    // Size of the channel.
+	Policy Policy // What to do when the channel is full.
+}
+
+// Broker routes every published message to the subscribers of its key.
+type Broker struct {
+	mu      sync.RWMutex
+	topics  *trie
+	subs    map[*PubSub]struct{}
+	durable map[string]*durable
+	closed  bool
+}
+
+// durable is a topic backed by a log. mu orders the appends and the deliveries, so subscribers
+// get the messages in offset order.
+type durable struct {
+	mu  sync.Mutex
+	log *Log
+}
+
+// NewBroker creates a broker for use.
+func NewBroker() *Broker {
+	return &Broker{
+		topics:  &trie{},
+		subs:    make(map[*PubSub]struct{}),
+		durable: make(map[string]*durable),
+	}
+}
+
+// Durable makes key a durable topic, with its log in cfg.Dir. Messages already in the log are
+// kept, so a broker started again picks up where it left off. Values published to a durable topic
+// are stored as JSON and every subscriber receives them as json.RawMessage.
+func (b *Broker) Durable(key string, cfg LogConfig) error {
+	l, err := OpenLog(cfg)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.closed:
+		l.Close()
+		return ErrClosed
+	case b.durable[key] != nil:
+		l.Close()
+		return errors.New("pubsub: topic " + key + " is already durable")
+	}
+
+	b.durable[key] = &durable{log: l}
+	return nil
+}
+
+// Publish sends v to every subscriber with a subscription matching key. It returns once every
+// subscriber has the message in its channel or dropped it, according to its Policy. For a durable
+// topic, the message is in the log first. The key can't have wildcards.
+func (b *Broker) Publish(key string, v interface{}) error {
+	if !validSubject(key) {
+		return ErrInvalidKey
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	d := b.durable[key]
+	b.mu.RUnlock()
+
+	if d != nil {
+		return b.publishDurable(d, key, v)
+	}
+
+	// Deliver outside of the lock, a Block subscriber can make us wait.
+	m := Message{Key: key, Value: v}
+	for _, ps := range b.subscribers(key) {
+		ps.deliver(m)
+	}
+
+	return nil
+}
+
+// publishDurable appends v to the log of a durable topic and delivers it.
+func (b *Broker) publishDurable(d *durable, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	off, err := d.log.Append(data)
+	if err != nil {
+		return err
+	}
+
+	m := durableMessage(key, off, data)
+	for _, ps := range b.subscribers(key) {
+		ps.deliver(m)
+	}
+
+	return nil
+}
+
+// durableMessage returns the message of a durable topic, the same on the live path and on replay.
+func durableMessage(key string, off int64, data []byte) Message {
+	return Message{Key: key, Value: json.RawMessage(data), Offset: off}
+}
+
+// subscribers returns the subscribers matching key right now.
+func (b *Broker) subscribers(key string) []*PubSub {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.topics == nil {
+		return nil
+	}
+
+	return b.topics.match(key)
+}
+
+// durableTopic returns the durable topic of key, or nil.
+func (b *Broker) durableTopic(key string) *durable {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.durable[key]
+}
+
+// Close closes every subscriber. Publish returns ErrClosed from then on.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+
+	subs := b.subs
+	durable := b.durable
+	b.topics = nil
+	b.subs = nil
+	b.durable = nil
+	b.mu.Unlock()
+
+	for ps := range subs {
+		ps.shutdown()
+	}
+
+	var err error
+	for _, d := range durable {
+		d.mu.Lock()
+		if cerr := d.log.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		d.mu.Unlock()
+	}
+
+	return err
+}
+
+// add registers ps as a subscriber of key.
+func (b *Broker) add(key string, ps *PubSub) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	b.topics.add(key, ps)
+	b.subs[ps] = struct{}{}
+
+	return nil
+}
+
+// remove unregisters ps from every key in keys.
+func (b *Broker) remove(ps *PubSub, keys ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, key := range keys {
+		b.topics.remove(key, ps)
+	}
+}
+
+// drop forgets ps entirely.
+func (b *Broker) drop(ps *PubSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs != nil {
+		delete(b.subs, ps)
+	}
+}
+
+// PubSub is one subscriber connected to a Broker. It can also publish.
+type PubSub struct {
+	broker *Broker
+	policy Policy
+	ch     chan Message
+
+	// mu serializes deliveries so a DropOldest subscriber is the only one taking from ch besides
+	// the reader, and so ch is never closed in the middle of a send.
+	mu   sync.Mutex
+	done chan struct{}
+	once sync.Once
+
+	keysMu sync.Mutex
+	keys   map[string]struct{}
+	err    error // why a replay closed the subscriber
+
+	dropped int64
+}
+
+// New creates a subscriber connected to b.
+func New(b *Broker, cfg Config) *PubSub {
+	buffer := cfg.Buffer
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	return &PubSub{
+		broker: b,
+		policy: cfg.Policy,
+		ch:     make(chan Message, buffer),
+		done:   make(chan struct{}),
+		keys:   make(map[string]struct{}),
+	}
+}
+
+// Publish sends the data to the specified key.
+func (ps *PubSub) Publish(key string, v interface{}) error {
+	return ps.broker.Publish(key, v)
+}
+
+// Subscribe sets up a request to receive messages from the specified key on the Messages channel.
+// The key can have wildcards, orders.> receives every message published under orders.
+func (ps *PubSub) Subscribe(key string) error {
+	if !validPattern(key) {
+		return ErrInvalidKey
+	}
+
+	ps.keysMu.Lock()
+	defer ps.keysMu.Unlock()
+
+	if ps.isClosed() {
+		return ErrClosed
+	}
+
+	if err := ps.broker.add(key, ps); err != nil {
+		return err
+	}
+	ps.keys[key] = struct{}{}
+
+	return nil
+}
+
+// SubscribeFrom subscribes to a durable topic starting at from: Earliest, Latest or an offset.
+// The messages already in the log are replayed in the background, in order, and then the
+// subscriber receives the new ones like any other. An offset removed by retention starts at the
+// earliest message kept, and the messages retention removes during the replay are skipped. If the
+// log can't be read the subscriber is closed and Err returns why.
+func (ps *PubSub) SubscribeFrom(key string, from int64) error {
+	if from == Latest {
+		return ps.Subscribe(key)
+	}
+
+	d := ps.broker.durableTopic(key)
+	if d == nil {
+		return ErrNotDurable
+	}
+
+	if ps.isClosed() {
+		return ErrClosed
+	}
+
+	go ps.catchUp(key, d, from)
+
+	return nil
+}
+
+// catchUp replays the log of d from offset from, then subscribes to key. The last check is made
+// holding the lock publishers append with, so no message is missed or received twice.
+func (ps *PubSub) catchUp(key string, d *durable, from int64) {
+	if earliest := d.log.Earliest(); from < earliest {
+		from = earliest
+	}
+
+	replay := func(off int64, _ time.Time, v []byte) error {
+		if ps.isClosed() {
+			return ErrClosed
+		}
+
+		ps.deliver(durableMessage(key, off, v))
+		return nil
+	}
+
+	for {
+		to := d.log.Next()
+		if err := d.log.Read(from, to, replay); err != nil {
+			if err != ErrClosed {
+				ps.keysMu.Lock()
+				ps.err = err
+				ps.keysMu.Unlock()
+				ps.Close()
+			}
+			return
+		}
+		from = to
+
+		d.mu.Lock()
+		if d.log.Next() == to {
+			ps.Subscribe(key)
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Unsubscribe stops messages from the specified key. Messages already in the channel stay there.
+func (ps *PubSub) Unsubscribe(key string) error {
+	ps.keysMu.Lock()
+	defer ps.keysMu.Unlock()
+
+	if ps.isClosed() {
+		return ErrClosed
+	}
+
+	ps.broker.remove(ps, key)
+	delete(ps.keys, key)
+
+	return nil
+}
+
+// Messages returns the channel messages are received on. It is closed by Close.
+func (ps *PubSub) Messages() <-chan Message {
+	return ps.ch
+}
+
+// Dropped returns how many messages the Policy threw away.
+func (ps *PubSub) Dropped() int64 {
+	return atomic.LoadInt64(&ps.dropped)
+}
+
+// Err returns the error that closed the subscriber during a replay, or nil.
+func (ps *PubSub) Err() error {
+	ps.keysMu.Lock()
+	defer ps.keysMu.Unlock()
+
+	return ps.err
+}
+
+// Close unsubscribes from every key and closes the Messages channel. A publisher blocked on this
+// subscriber is released.
+func (ps *PubSub) Close() error {
+	ps.keysMu.Lock()
+
+	// Shutdown first so a Subscribe running right now fails instead of adding a key.
+	ps.shutdown()
+
+	keys := make([]string, 0, len(ps.keys))
+	for key := range ps.keys {
+		keys = append(keys, key)
+	}
+	ps.keysMu.Unlock()
+
+	ps.broker.remove(ps, keys...)
+	ps.broker.drop(ps)
+
+	return nil
+}
+
+// shutdown closes the channel once.
+func (ps *PubSub) shutdown() {
+	ps.once.Do(func() {
+		close(ps.done)
+
+		// Wait for a delivery in progress to see done and leave.
+		ps.mu.Lock()
+		close(ps.ch)
+		ps.mu.Unlock()
+	})
+}
+
+// isClosed reports whether Close was called.
+func (ps *PubSub) isClosed() bool {
+	select {
+	case <-ps.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver puts m in the channel according to the Policy.
+func (ps *PubSub) deliver(m Message) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.isClosed() {
+		return
+	}
+
+	switch ps.policy {
+	case DropNewest:
+		select {
+		case ps.ch <- m:
+		default:
+			atomic.AddInt64(&ps.dropped, 1)
+		}
+
+	case DropOldest:
+		for {
+			select {
+			case ps.ch <- m:
+				return
+			default:
+			}
+
+			// Nothing to drop in an unbuffered channel, the new message goes instead.
+			if cap(ps.ch) == 0 {
+				atomic.AddInt64(&ps.dropped, 1)
+				return
+			}
+
+			select {
+			case <-ps.ch:
+				atomic.AddInt64(&ps.dropped, 1)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case ps.ch <- m:
+		case <-ps.done:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Run test using "go test -v -race"
+
+package pubsub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/pubsub"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// publisher is the interface from mocking_2.go. PubSub must keep satisfying it.
+type publisher interface {
+	Publish(key string, v interface{}) error
+	Subscribe(key string) error
+}
+
+var _ publisher = (*pubsub.PubSub)(nil)
+
+// receive returns the values waiting in the channel without blocking.
+func receive(ps *pubsub.PubSub) []interface{} {
+	var vs []interface{}
+	for {
+		select {
+		case m := <-ps.Messages():
+			vs = append(vs, m.Value)
+		default:
+			return vs
+		}
+	}
+}
+
+// TestPublish validates messages go to the subscribers of their key only.
+func TestPublish(t *testing.T) {
+	b := pubsub.NewBroker()
+	defer b.Close()
+
+	orders := pubsub.New(b, pubsub.Config{Buffer: 10})
+	users := pubsub.New(b, pubsub.Config{Buffer: 10})
+
+	orders.Subscribe("orders")
+	users.Subscribe("users")
+
+	t.Log("Given the need to route messages by key.")
+	{
+		orders.Publish("orders", 1)
+		users.Publish("users", 2)
+		users.Publish("nobody", 3)
+
+		if vs := receive(orders); len(vs) != 1 || vs[0] != 1 {
+			t.Fatalf("\t%s\tShould only get the orders : %v", failed, vs)
+		}
+		t.Logf("\t%s\tShould only get the orders.", succeed)
+
+		if vs := receive(users); len(vs) != 1 || vs[0] != 2 {
+			t.Fatalf("\t%s\tShould only get the users : %v", failed, vs)
+		}
+		t.Logf("\t%s\tShould only get the users.", succeed)
+
+		orders.Unsubscribe("orders")
+		orders.Publish("orders", 4)
+		if vs := receive(orders); len(vs) != 0 {
+			t.Fatalf("\t%s\tShould get nothing after Unsubscribe : %v", failed, vs)
+		}
+		t.Logf("\t%s\tShould get nothing after Unsubscribe.", succeed)
+	}
+}
+
+// TestPolicy validates what happens to a subscriber that is not keeping up.
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		policy  pubsub.Policy
+		want    []interface{}
+		dropped int64
+	}{
+		{pubsub.DropOldest, []interface{}{3, 4}, 2},
+		{pubsub.DropNewest, []interface{}{1, 2}, 2},
+	}
+
+	t.Log("Given the need to handle a slow subscriber.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen using %v with a buffer of 2.", i, tt.policy)
+			{
+				b := pubsub.NewBroker()
+				ps := pubsub.New(b, pubsub.Config{Buffer: 2, Policy: tt.policy})
+				ps.Subscribe("key")
+
+				for v := 1; v <= 4; v++ {
+					b.Publish("key", v)
+				}
+
+				vs := receive(ps)
+				if len(vs) != 2 || vs[0] != tt.want[0] || vs[1] != tt.want[1] {
+					t.Errorf("\t%s\tShould receive %v : %v", failed, tt.want, vs)
+				} else {
+					t.Logf("\t%s\tShould receive %v.", succeed, tt.want)
+				}
+
+				if ps.Dropped() != tt.dropped {
+					t.Errorf("\t%s\tShould drop %d : %d", failed, tt.dropped, ps.Dropped())
+				} else {
+					t.Logf("\t%s\tShould drop %d.", succeed, tt.dropped)
+				}
+
+				b.Close()
+			}
+		}
+
+		t.Logf("\tTest 2:\tWhen using block and the subscriber closes.")
+		{
+			b := pubsub.NewBroker()
+			ps := pubsub.New(b, pubsub.Config{Policy: pubsub.Block})
+			ps.Subscribe("key")
+
+			done := make(chan error)
+			go func() {
+				done <- b.Publish("key", 1)
+			}()
+
+			select {
+			case <-done:
+				t.Fatalf("\t%s\tShould block the publisher.", failed)
+			case <-time.After(50 * time.Millisecond):
+			}
+			t.Logf("\t%s\tShould block the publisher.", succeed)
+
+			ps.Close()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tShould release the publisher on Close.", failed)
+			}
+			t.Logf("\t%s\tShould release the publisher on Close.", succeed)
+
+			if _, ok := <-ps.Messages(); ok {
+				t.Fatalf("\t%s\tShould close the channel.", failed)
+			}
+			t.Logf("\t%s\tShould close the channel.", succeed)
+
+			if err := ps.Subscribe("key"); err != pubsub.ErrClosed {
+				t.Fatalf("\t%s\tShould not subscribe after Close : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould not subscribe after Close.", succeed)
+
+			b.Close()
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The protocol is one command per line, so it can be typed into telnet.
+//
+//	Client to server:
+//	  SUB <key>           receive messages published to key
+//	  UNSUB <key>         stop receiving them
+//	  PUB <key> <json>    publish the JSON value to key
+//	  PING                ask for a PONG, this is the heartbeat
+//
+//	Server to client:
+//	  MSG <key> <json>    a message for a subscribed key
+//	  PONG                the answer to PING
+//	  OK                  the command was accepted
+//	  ERR <reason>        the command was rejected
+//
+// Every SUB, UNSUB and PUB gets an OK or an ERR, in the order they were sent, so the client knows
+// which command a reply is for. Keys can't contain white space. Values are compact JSON, which
+// never contains a new line.
+
+// ErrServerClosed is returned by Serve after Shutdown.
+var ErrServerClosed = errors.New("pubsub: server closed")
+
+// DefaultHeartbeat is how often a client pings when no heartbeat is given. The server and the
+// client both give up on a connection that was quiet for twice as long.
+const DefaultHeartbeat = 15 * time.Second
+
+// maxLine is the longest line, and so the largest message, either side accepts.
+const maxLine = 1 << 20
+
+// validKey reports whether key can be sent over the protocol.
+func validKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, " \t\r\n")
+}
+
+// Server serves a Broker to clients over TCP.
+type Server struct {
+	Addr       string        // TCP address to listen on, like "localhost:4222".
+	Broker     *Broker       // Broker to serve. NewBroker is used when it is nil.
+	Subscriber Config        // How every connection receives its messages.
+	Heartbeat  time.Duration // A connection quiet for twice this long is closed.
+
+	mu       sync.Mutex
+	ln       net.Listener
+	conns    map[*conn]struct{}
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+// conn is one client connection and the subscriber behind it.
+type conn struct {
+	c   net.Conn
+	sub *PubSub
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// write sends one line and flushes it.
+func (c *conn) write(timeout time.Duration, format string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.c.SetWriteDeadline(time.Now().Add(timeout))
+
+	fmt.Fprintf(c.w, format, args...)
+	c.w.WriteByte('\n')
+	return c.w.Flush()
+}
+
+// ListenAndServe listens on Addr and serves until Shutdown.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Shutdown. It always returns a non-nil error.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+
+	s.ln = ln
+	if s.Broker == nil {
+		s.Broker = NewBroker()
+	}
+	s.mu.Unlock()
+
+	var wait time.Duration
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			shutdown := s.shutdown
+			s.mu.Unlock()
+
+			if shutdown {
+				return ErrServerClosed
+			}
+
+			// Like net/http, wait and try again when it can work, like too many open files.
+			if e, ok := err.(temporary); ok && e.Temporary() {
+				if wait = 2 * wait; wait == 0 {
+					wait = 5 * time.Millisecond
+				} else if wait > time.Second {
+					wait = time.Second
+				}
+				time.Sleep(wait)
+				continue
+			}
+
+			return err
+		}
+		wait = 0
+
+		s.mu.Lock()
+		if s.shutdown {
+			s.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+
+		cn := conn{
+			c:   c,
+			sub: New(s.Broker, s.Subscriber),
+			w:   bufio.NewWriter(c),
+		}
+		if s.conns == nil {
+			s.conns = make(map[*conn]struct{})
+		}
+		s.conns[&cn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(&cn)
+	}
+}
+
+// temporary is the behavior of the errors Accept returns when trying again can work. It is
+// behavior as context from error_4.go.
+type temporary interface {
+	Temporary() bool
+}
+
+// Listener returns the listener Serve is using, so a test that listens on port 0 can find the
+// address. It is nil before Serve is called.
+func (s *Server) Listener() net.Listener {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ln
+}
+
+// Shutdown stops accepting connections and closes every subscriber. Each connection is closed
+// once the messages already queued for it are written. If ctx is done first, the connections
+// left are closed right away and the ctx error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+
+	conns := make([]*conn, 0, len(s.conns))
+	for cn := range s.conns {
+		conns = append(conns, cn)
+	}
+	s.mu.Unlock()
+
+	for _, cn := range conns {
+		cn.sub.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, cn := range conns {
+			cn.c.Close()
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// heartbeat returns the heartbeat, or the default.
+func (s *Server) heartbeat() time.Duration {
+	if s.Heartbeat <= 0 {
+		return DefaultHeartbeat
+	}
+	return s.Heartbeat
+}
+
+// serve runs one connection. The Goroutine running serve reads the commands, a second one writes
+// the messages.
+func (s *Server) serve(cn *conn) {
+	defer s.wg.Done()
+
+	timeout := 2 * s.heartbeat()
+
+	writer := make(chan struct{})
+	go func() {
+		defer close(writer)
+
+		for m := range cn.sub.Messages() {
+			data, err := json.Marshal(m.Value)
+			if err != nil {
+				continue
+			}
+
+			if err := cn.write(timeout, "MSG %s %s", m.Key, data); err != nil {
+				// Keep draining until the channel is closed so no publisher waits on us.
+				cn.sub.Close()
+			}
+		}
+
+		// Everything queued is written, the reader is done with the connection as well.
+		cn.c.Close()
+	}()
+
+	sc := bufio.NewScanner(cn.c)
+	sc.Buffer(make([]byte, 4096), maxLine)
+
+	for {
+		cn.c.SetReadDeadline(time.Now().Add(timeout))
+		if !sc.Scan() {
+			break
+		}
+
+		reply, err := s.command(cn, sc.Bytes())
+		if err != nil {
+			reply = fmt.Sprintf("ERR %v", err)
+		}
+		cn.write(timeout, "%s", reply)
+	}
+
+	cn.sub.Close()
+	<-writer
+
+	s.mu.Lock()
+	delete(s.conns, cn)
+	s.mu.Unlock()
+}
+
+// command runs one line from a client and returns the reply to send back.
+func (s *Server) command(cn *conn, line []byte) (string, error) {
+	parts := bytes.SplitN(bytes.TrimSpace(line), []byte(" "), 3)
+
+	switch cmd := string(parts[0]); {
+	case cmd == "PING" && len(parts) == 1:
+		return "PONG", nil
+
+	case (cmd == "SUB" || cmd == "UNSUB") && len(parts) == 2:
+		key := string(parts[1])
+		if !validKey(key) {
+			return "", ErrInvalidKey
+		}
+
+		var err error
+		if cmd == "SUB" {
+			err = cn.sub.Subscribe(key)
+		} else {
+			err = cn.sub.Unsubscribe(key)
+		}
+		return "OK", err
+
+	case cmd == "PUB" && len(parts) == 3:
+		key := string(parts[1])
+		if !validKey(key) {
+			return "", ErrInvalidKey
+		}
+		if !json.Valid(parts[2]) {
+			return "", errors.New("invalid JSON")
+		}
+
+		// The scanner reuses its buffer, subscribers need their own copy.
+		v := make(json.RawMessage, len(parts[2]))
+		copy(v, parts[2])
+		return "OK", s.Broker.Publish(key, v)
+	}
+
+	return "", fmt.Errorf("unknown command %q", parts[0])
+}
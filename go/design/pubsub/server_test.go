@@ -0,0 +1,240 @@
+package pubsub_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/pubsub"
+)
+
+var _ publisher = (*pubsub.Client)(nil)
+
+// startServer runs a server on addr until the test is over.
+func startServer(t *testing.T, addr string) *pubsub.Server {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to listen : %v", failed, err)
+	}
+
+	s := pubsub.Server{
+		Subscriber: pubsub.Config{Buffer: 10, Policy: pubsub.DropOldest},
+		Heartbeat:  50 * time.Millisecond,
+	}
+	go s.Serve(ln)
+
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+	})
+
+	for s.Listener() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	return &s
+}
+
+// await publishes v with pub until sub receives it. After a reconnect, the client subscribes again
+// in the background, so the first few messages can go out before the server knows about it.
+func await(t *testing.T, pub, sub *pubsub.Client, key string, v int) bool {
+	deadline := time.After(2 * time.Second)
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+
+	pub.Publish(key, v)
+	for {
+		select {
+		case m := <-sub.Messages():
+			var got int
+			if err := json.Unmarshal(m.Value.(json.RawMessage), &got); err == nil && m.Key == key && got == v {
+				return true
+			}
+		case <-tick.C:
+			pub.Publish(key, v)
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// TestClient validates clients exchange messages through a server on localhost.
+func TestClient(t *testing.T) {
+	s := startServer(t, "127.0.0.1:0")
+	addr := s.Listener().Addr().String()
+
+	t.Log("Given the need to publish and subscribe over TCP.")
+	{
+		pub, err := pubsub.Dial(addr, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to dial : %v", failed, err)
+		}
+		defer pub.Close()
+
+		sub, err := pubsub.Dial(addr, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to dial : %v", failed, err)
+		}
+		defer sub.Close()
+
+		t.Logf("\tTest 0:\tWhen subscribed to a key.")
+		{
+			sub.Subscribe("orders")
+			if !await(t, pub, sub, "orders", 1) {
+				t.Fatalf("\t%s\tShould receive the message.", failed)
+			}
+			t.Logf("\t%s\tShould receive the message.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen idle for longer than the heartbeat.")
+		{
+			time.Sleep(300 * time.Millisecond)
+			if !await(t, pub, sub, "orders", 2) {
+				t.Fatalf("\t%s\tShould still be connected.", failed)
+			}
+			t.Logf("\t%s\tShould still be connected.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen the server restarts.")
+		{
+			s.Shutdown(context.Background())
+			startServer(t, addr)
+
+			if !await(t, pub, sub, "orders", 3) {
+				t.Fatalf("\t%s\tShould reconnect and subscribe again.", failed)
+			}
+			t.Logf("\t%s\tShould reconnect and subscribe again.", succeed)
+		}
+
+		t.Logf("\tTest 3:\tWhen the server rejects a command.")
+		{
+			err := pub.Publish("orders.*", 4)
+
+			var se *pubsub.ServerError
+			if !errors.As(err, &se) || !errors.Is(err, pubsub.ErrInvalidKey) {
+				t.Fatalf("\t%s\tShould not publish to a wildcard : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould not publish to a wildcard.", succeed)
+
+			if err := sub.Subscribe("orders..eu"); !errors.Is(err, pubsub.ErrInvalidKey) {
+				t.Fatalf("\t%s\tShould not subscribe to an invalid key : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould not subscribe to an invalid key.", succeed)
+
+			if err := pub.Publish("orders", 5); err != nil {
+				t.Fatalf("\t%s\tShould still publish to a valid key : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould still publish to a valid key.", succeed)
+		}
+	}
+}
+
+// TestServer validates the server side of the protocol.
+func TestServer(t *testing.T) {
+	s := startServer(t, "127.0.0.1:0")
+	addr := s.Listener().Addr().String()
+
+	t.Log("Given the need to serve raw connections.")
+	{
+		t.Logf("\tTest 0:\tWhen a connection sends a bad command.")
+		{
+			c, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to dial : %v", failed, err)
+			}
+			defer c.Close()
+
+			r := bufio.NewReader(c)
+
+			c.Write([]byte("PUB orders {bad\n"))
+			if line, _ := r.ReadString('\n'); line != "ERR invalid JSON\n" {
+				t.Fatalf("\t%s\tShould get an ERR : %q", failed, line)
+			}
+			t.Logf("\t%s\tShould get an ERR.", succeed)
+
+			c.Write([]byte("SUB orders\n"))
+			if line, _ := r.ReadString('\n'); line != "OK\n" {
+				t.Fatalf("\t%s\tShould get an OK : %q", failed, line)
+			}
+			t.Logf("\t%s\tShould get an OK.", succeed)
+
+			c.Write([]byte("PING\n"))
+			if line, _ := r.ReadString('\n'); line != "PONG\n" {
+				t.Fatalf("\t%s\tShould get a PONG : %q", failed, line)
+			}
+			t.Logf("\t%s\tShould get a PONG.", succeed)
+
+			// Quiet for more than 2 heartbeats.
+			if _, err := r.ReadString('\n'); err == nil {
+				t.Fatalf("\t%s\tShould close a quiet connection.", failed)
+			}
+			t.Logf("\t%s\tShould close a quiet connection.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen Accept fails with a temporary error.")
+		{
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to listen : %v", failed, err)
+			}
+
+			var s pubsub.Server
+			go s.Serve(&flakyListener{Listener: ln, fails: 3})
+			defer s.Shutdown(context.Background())
+
+			c, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to dial : %v", failed, err)
+			}
+			defer c.Close()
+
+			c.Write([]byte("PING\n"))
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			if line, _ := bufio.NewReader(c).ReadString('\n'); line != "PONG\n" {
+				t.Fatalf("\t%s\tShould keep accepting : %q", failed, line)
+			}
+			t.Logf("\t%s\tShould keep accepting.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen shutting down.")
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if err := s.Shutdown(ctx); err != nil {
+				t.Fatalf("\t%s\tShould shut down in time : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould shut down in time.", succeed)
+
+			if _, err := net.Dial("tcp", addr); err == nil {
+				t.Fatalf("\t%s\tShould not accept connections.", failed)
+			}
+			t.Logf("\t%s\tShould not accept connections.", succeed)
+		}
+	}
+}
+
+// flakyListener fails the first Accepts with a temporary error, like running out of file
+// descriptors.
+type flakyListener struct {
+	net.Listener
+	fails int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.fails > 0 {
+		l.fails--
+		return nil, tempError{}
+	}
+	return l.Listener.Accept()
+}
+
+// tempError is a temporary net.Error.
+type tempError struct{}
+
+func (tempError) Error() string   { return "too many open files" }
+func (tempError) Timeout() bool   { return false }
+func (tempError) Temporary() bool { return true }
@@ -0,0 +1,134 @@
+package pubsub
+
+import "strings"
+
+// Keys are hierarchical, made of tokens separated by dots, like orders.eu.created. A subscription
+// can use two wildcards in place of whole tokens:
+//
+//	*   matches exactly one token:          orders.*.created matches orders.eu.created
+//	>   matches one or more tokens, last:   orders.> matches orders.eu and orders.eu.created
+//
+// Publishing to a key with a wildcard is not allowed.
+
+// trie indexes the subscriptions by their tokens. Matching a key walks one path per token and
+// per wildcard, so it does not get slower as more subscriptions are added to other branches.
+type trie struct {
+	root node
+}
+
+// node is one token of a subscription.
+type node struct {
+	children map[string]*node
+	subs     map[*PubSub]struct{} // subscriptions ending here
+}
+
+// validPattern reports whether pattern is a key or a subscription with valid wildcards.
+func validPattern(pattern string) bool {
+	tokens := strings.Split(pattern, ".")
+	for i, tok := range tokens {
+		if tok == "" || (tok == ">" && i != len(tokens)-1) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validSubject reports whether key can be published to.
+func validSubject(key string) bool {
+	if !validPattern(key) {
+		return false
+	}
+
+	for _, tok := range strings.Split(key, ".") {
+		if tok == "*" || tok == ">" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// add subscribes ps to pattern.
+func (t *trie) add(pattern string, ps *PubSub) {
+	n := &t.root
+	for _, tok := range strings.Split(pattern, ".") {
+		if n.children == nil {
+			n.children = make(map[string]*node)
+		}
+
+		child, ok := n.children[tok]
+		if !ok {
+			child = &node{}
+			n.children[tok] = child
+		}
+		n = child
+	}
+
+	if n.subs == nil {
+		n.subs = make(map[*PubSub]struct{})
+	}
+	n.subs[ps] = struct{}{}
+}
+
+// remove unsubscribes ps from pattern and removes the nodes nobody needs anymore.
+func (t *trie) remove(pattern string, ps *PubSub) {
+	tokens := strings.Split(pattern, ".")
+
+	path := []*node{&t.root}
+	for _, tok := range tokens {
+		child, ok := path[len(path)-1].children[tok]
+		if !ok {
+			return
+		}
+		path = append(path, child)
+	}
+
+	delete(path[len(path)-1].subs, ps)
+
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if len(n.subs) > 0 || len(n.children) > 0 {
+			return
+		}
+		delete(path[i-1].children, tokens[i-1])
+	}
+}
+
+// match returns every subscriber with a subscription matching key, once.
+func (t *trie) match(key string) []*PubSub {
+	set := make(map[*PubSub]struct{})
+	t.root.match(strings.Split(key, "."), set)
+
+	subs := make([]*PubSub, 0, len(set))
+	for ps := range set {
+		subs = append(subs, ps)
+	}
+
+	return subs
+}
+
+// match adds the subscribers of the tokens left to set.
+func (n *node) match(tokens []string, set map[*PubSub]struct{}) {
+	if len(tokens) == 0 {
+		for ps := range n.subs {
+			set[ps] = struct{}{}
+		}
+		return
+	}
+
+	if child, ok := n.children[tokens[0]]; ok {
+		child.match(tokens[1:], set)
+	}
+
+	if child, ok := n.children["*"]; ok {
+		child.match(tokens[1:], set)
+	}
+
+	// There is at least one token left, that is all > needs.
+	if child, ok := n.children[">"]; ok {
+		for ps := range child.subs {
+			set[ps] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pubsub_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/pubsub"
+)
+
+// TestWildcard validates which keys every kind of subscription matches.
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"orders.eu.created", "orders.eu.created", true},
+		{"orders.eu.created", "orders.us.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.*.created", "orders.eu.deleted", false},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.>", "orders.eu", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"*.*.created", "orders.eu.created", true},
+		{">", "orders", true},
+	}
+
+	t.Log("Given the need to subscribe to families of keys.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen subscribed to %s.", i, tt.pattern)
+			{
+				b := pubsub.NewBroker()
+				ps := pubsub.New(b, pubsub.Config{Buffer: 1})
+
+				if err := ps.Subscribe(tt.pattern); err != nil {
+					t.Fatalf("\t%s\tShould subscribe : %v", failed, err)
+				}
+				b.Publish(tt.key, 1)
+
+				if got := len(receive(ps)) == 1; got != tt.match {
+					t.Errorf("\t%s\tShould match %s %v : %v", failed, tt.key, tt.match, got)
+				} else {
+					t.Logf("\t%s\tShould match %s %v.", succeed, tt.key, tt.match)
+				}
+
+				b.Close()
+			}
+		}
+
+		t.Logf("\tTest %d:\tWhen more than one subscription matches.", len(tests))
+		{
+			b := pubsub.NewBroker()
+			defer b.Close()
+
+			ps := pubsub.New(b, pubsub.Config{Buffer: 10})
+			ps.Subscribe("orders.>")
+			ps.Subscribe("orders.*.created")
+			ps.Subscribe("orders.eu.created")
+
+			b.Publish("orders.eu.created", 1)
+			if vs := receive(ps); len(vs) != 1 {
+				t.Fatalf("\t%s\tShould receive the message once : %v", failed, vs)
+			}
+			t.Logf("\t%s\tShould receive the message once.", succeed)
+
+			ps.Unsubscribe("orders.>")
+			b.Publish("orders.eu", 2)
+			if vs := receive(ps); len(vs) != 0 {
+				t.Fatalf("\t%s\tShould stop matching after Unsubscribe : %v", failed, vs)
+			}
+			t.Logf("\t%s\tShould stop matching after Unsubscribe.", succeed)
+		}
+
+		t.Logf("\tTest %d:\tWhen using invalid keys.", len(tests)+1)
+		{
+			b := pubsub.NewBroker()
+			defer b.Close()
+
+			ps := pubsub.New(b, pubsub.Config{})
+			for _, key := range []string{"", "orders..eu", "orders.>.eu"} {
+				if err := ps.Subscribe(key); err != pubsub.ErrInvalidKey {
+					t.Errorf("\t%s\tShould not subscribe to %q : %v", failed, key, err)
+				}
+			}
+			if err := b.Publish("orders.*", 1); err != pubsub.ErrInvalidKey {
+				t.Errorf("\t%s\tShould not publish to a wildcard : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould reject invalid keys.", succeed)
+		}
+	}
+}
+
+// BenchmarkPublish publishes to a broker with 50,000 subscriptions, a few of them matching.
+// Run: go test -run none -bench . -benchmem
+func BenchmarkPublish(b *testing.B) {
+	br := pubsub.NewBroker()
+	defer br.Close()
+
+	for i := 0; i < 50000; i++ {
+		ps := pubsub.New(br, pubsub.Config{Buffer: 1, Policy: pubsub.DropOldest})
+		ps.Subscribe(fmt.Sprintf("orders.region%d.created", i))
+	}
+
+	ps := pubsub.New(br, pubsub.Config{Buffer: 1, Policy: pubsub.DropOldest})
+	ps.Subscribe("orders.*.created")
+	ps.Subscribe("orders.>")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		br.Publish("orders.region42.created", i)
+	}
+}
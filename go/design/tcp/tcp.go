@@ -0,0 +1,313 @@
+// Package tcp provides the TCP server behind the Server in pollution_2.go.
+//
+// It keeps the same concrete API: NewServer, then Start, Stop and Wait. Start binds and accepts
+// connections into a Handler. Stop stops accepting and drains: the handlers are told through
+// their context, a connection waiting for its next request is woken up and the ones in the middle
+// of a request finish it. Wait blocks until every connection is done.
+//
+// The server doesn't know the protocol, so it can't see where a request starts or ends. It
+// assumes requests and responses take turns: a connection is idle from the moment it writes a
+// response, or is accepted, until it reads the first byte of the next request. Only idle
+// connections are woken up by Stop.
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Handler serves one connection. The server closes the connection when ServeConn returns.
+// ctx is cancelled when the server stops, finish the request in progress and return.
+type Handler interface {
+	ServeConn(ctx context.Context, c net.Conn)
+}
+
+// HandlerFunc lets an ordinary function be a Handler.
+type HandlerFunc func(ctx context.Context, c net.Conn)
+
+// ServeConn calls f(ctx, c).
+func (f HandlerFunc) ServeConn(ctx context.Context, c net.Conn) {
+	f(ctx, c)
+}
+
+// ErrServerStarted is returned by Start when the server already started.
+var ErrServerStarted = errors.New("tcp: server already started")
+
+// Server accepts TCP connections on Host and hands them to Handler.
+type Server struct {
+	Host         string        // Address to listen on, like "localhost:6000".
+	Handler      Handler       // Serves every connection.
+	MaxConns     int           // Connections served at once. 0 is no limit.
+	IdleTimeout  time.Duration // Closes a connection quiet for this long. 0 is no limit.
+	WriteTimeout time.Duration // Fails a write that takes longer than this. 0 is no limit.
+
+	mu       sync.Mutex
+	ln       net.Listener
+	conns    map[*conn]struct{}
+	stopping bool
+	err      error // why the accept loop ended, when it wasn't Stop
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// NewServer returns just a concrete pointer of type Server.
+func NewServer(host string, h Handler) *Server {
+	return &Server{
+		Host:    host,
+		Handler: h,
+	}
+}
+
+// Start binds to Host and begins to accept connections in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		return ErrServerStarted
+	}
+
+	ln, err := net.Listen("tcp", s.Host)
+	if err != nil {
+		return err
+	}
+
+	s.ln = ln
+	s.conns = make(map[*conn]struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.done = make(chan struct{})
+
+	s.wg.Add(1)
+	go s.accept()
+
+	// Wait closes done once the accept loop and every connection are finished.
+	go func() {
+		s.wg.Wait()
+		close(s.done)
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on, useful after listening on port 0.
+// It is nil before Start.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Stop stops accepting connections and tells every connection to finish. It does not wait, use
+// Wait for that.
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done == nil || s.stopping {
+		return nil
+	}
+	s.stopping = true
+
+	s.cancel()
+	err := s.ln.Close()
+
+	// Wake up the connections waiting for a request. The ones in the middle of one finish it, and
+	// their next read after the response sees the cancel.
+	for c := range s.conns {
+		c.wake()
+	}
+
+	return err
+}
+
+// Close stops the server and closes every connection right away.
+func (s *Server) Close() error {
+	err := s.Stop()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	return err
+}
+
+// Wait blocks until the server is stopped and every connection is done. It returns the error
+// that stopped the server from accepting, or nil after Stop. Call it after Start.
+func (s *Server) Wait() error {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	<-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// temporary is the behavior of the errors Accept returns when trying again can work, like too many
+// open files. It is behavior as context from error_4.go.
+type temporary interface {
+	Temporary() bool
+}
+
+// accept runs the accept loop until Stop or an error Accept can't recover from.
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	var sem chan struct{}
+	if s.MaxConns > 0 {
+		sem = make(chan struct{}, s.MaxConns)
+	}
+
+	var wait time.Duration
+	for {
+		// Hold off accepting while at the limit. The connections wait in the listen backlog.
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+
+		nc, err := s.ln.Accept()
+		if err != nil {
+			if sem != nil {
+				<-sem
+			}
+
+			if s.ctx.Err() != nil {
+				return
+			}
+
+			if e, ok := err.(temporary); ok && e.Temporary() {
+				if wait = 2 * wait; wait == 0 {
+					wait = 5 * time.Millisecond
+				} else if wait > time.Second {
+					wait = time.Second
+				}
+				time.Sleep(wait)
+				continue
+			}
+
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+
+			// Nothing more will be accepted, drain like Stop does.
+			s.Stop()
+			return
+		}
+		wait = 0
+
+		c := conn{Conn: nc, s: s, idle: true}
+
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[&c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				c.Close()
+
+				s.mu.Lock()
+				delete(s.conns, &c)
+				s.mu.Unlock()
+
+				if sem != nil {
+					<-sem
+				}
+				s.wg.Done()
+			}()
+
+			s.Handler.ServeConn(s.ctx, &c)
+		}()
+	}
+}
+
+// conn applies the timeouts and the drain to every read and write.
+type conn struct {
+	net.Conn
+	s *Server
+
+	mu   sync.Mutex
+	idle bool // waiting for the next request
+}
+
+// Read reads with a deadline of IdleTimeout from now. Once the server is stopping, an idle
+// connection reads with a deadline of right now instead.
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+
+	// Always set, so a deadline Stop set while we were idle doesn't cut the request short.
+	var deadline time.Time
+	if c.s.IdleTimeout > 0 {
+		deadline = time.Now().Add(c.s.IdleTimeout)
+	}
+	c.Conn.SetReadDeadline(deadline)
+
+	// Checked after setting the deadline: Stop cancels before it calls wake, so either we see the
+	// cancel here or wake's deadline comes after ours.
+	if c.idle && c.s.ctx.Err() != nil {
+		c.Conn.SetReadDeadline(time.Now())
+	}
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		c.idle = false
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// Write writes with a deadline of WriteTimeout from now, so a client that doesn't read can't keep
+// the connection, and Wait, forever. Once written, the response is done and the connection idle.
+func (c *conn) Write(b []byte) (int, error) {
+	if c.s.WriteTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.s.WriteTimeout))
+	}
+
+	n, err := c.Conn.Write(b)
+
+	c.mu.Lock()
+	c.idle = true
+	c.mu.Unlock()
+
+	return n, err
+}
+
+// wake interrupts the read of an idle connection. The caller cancelled the server context first.
+func (c *conn) wake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.idle {
+		c.Conn.SetReadDeadline(time.Now())
+	}
+}
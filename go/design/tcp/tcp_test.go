@@ -0,0 +1,238 @@
+// Run test using "go test -v -race"
+
+package tcp_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/tcp"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// echo answers every line after taking delay to process it.
+func echo(delay time.Duration) tcp.Handler {
+	return tcp.HandlerFunc(func(ctx context.Context, c net.Conn) {
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			time.Sleep(delay)
+			c.Write([]byte(strings.ToUpper(line)))
+		}
+	})
+}
+
+// start runs a server on a free port.
+func start(t *testing.T, s *tcp.Server) {
+	s.Host = "127.0.0.1:0"
+	if err := s.Start(); err != nil {
+		t.Fatalf("\t%s\tShould start : %v", failed, err)
+	}
+}
+
+// call sends a line on c and returns the answer.
+func call(c net.Conn, line string) (string, error) {
+	if _, err := c.Write([]byte(line + "\n")); err != nil {
+		return "", err
+	}
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	return bufio.NewReader(c).ReadString('\n')
+}
+
+// TestDrain validates Stop lets the request in progress finish and wakes up idle connections.
+func TestDrain(t *testing.T) {
+	s := tcp.Server{Handler: echo(100 * time.Millisecond)}
+	start(t, &s)
+
+	t.Log("Given the need to stop a server without cutting requests short.")
+	{
+		busy, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatalf("\t%s\tShould dial : %v", failed, err)
+		}
+		defer busy.Close()
+
+		idle, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatalf("\t%s\tShould dial : %v", failed, err)
+		}
+		defer idle.Close()
+
+		answer := make(chan string)
+		go func() {
+			line, _ := call(busy, "hello")
+			answer <- line
+		}()
+
+		// Stop while the request is being processed.
+		time.Sleep(30 * time.Millisecond)
+		s.Stop()
+
+		if line := <-answer; line != "HELLO\n" {
+			t.Fatalf("\t%s\tShould finish the request in progress : %q", failed, line)
+		}
+		t.Logf("\t%s\tShould finish the request in progress.", succeed)
+
+		done := make(chan error)
+		go func() { done <- s.Wait() }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("\t%s\tShould drain without error : %v", failed, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("\t%s\tShould not wait for the idle connection.", failed)
+		}
+		t.Logf("\t%s\tShould drain every connection.", succeed)
+
+		if _, err := net.Dial("tcp", s.Addr().String()); err == nil {
+			t.Fatalf("\t%s\tShould not accept after Stop.", failed)
+		}
+		t.Logf("\t%s\tShould not accept after Stop.", succeed)
+	}
+}
+
+// TestDrainRequest validates Stop doesn't cut off a request that takes more than one read.
+func TestDrainRequest(t *testing.T) {
+	// Every request is a header line and a body line, the answer is the body.
+	h := tcp.HandlerFunc(func(ctx context.Context, c net.Conn) {
+		r := bufio.NewReader(c)
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+
+			body, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			c.Write([]byte(strings.ToUpper(body)))
+		}
+	})
+
+	s := tcp.Server{Handler: h}
+	start(t, &s)
+
+	t.Log("Given the need to stop a server while a request is half read.")
+	{
+		c, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatalf("\t%s\tShould dial : %v", failed, err)
+		}
+		defer c.Close()
+
+		c.Write([]byte("header\n"))
+		time.Sleep(30 * time.Millisecond)
+		s.Stop()
+		time.Sleep(30 * time.Millisecond)
+
+		if line, err := call(c, "body"); line != "BODY\n" {
+			t.Fatalf("\t%s\tShould read the rest of the request : %q %v", failed, line, err)
+		}
+		t.Logf("\t%s\tShould read the rest of the request.", succeed)
+
+		done := make(chan error)
+		go func() { done <- s.Wait() }()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("\t%s\tShould close the connection once the response is written.", failed)
+		}
+		t.Logf("\t%s\tShould close the connection once the response is written.", succeed)
+	}
+}
+
+// TestWriteTimeout validates a client that doesn't read can't keep the server from stopping.
+func TestWriteTimeout(t *testing.T) {
+	// The answer is far bigger than what the socket buffers hold.
+	h := tcp.HandlerFunc(func(ctx context.Context, c net.Conn) {
+		big := make([]byte, 1<<20)
+		for {
+			if _, err := c.Write(big); err != nil {
+				return
+			}
+		}
+	})
+
+	s := tcp.Server{Handler: h, WriteTimeout: 100 * time.Millisecond}
+	start(t, &s)
+
+	t.Log("Given the need to stop a server with a client that doesn't read.")
+	{
+		c, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatalf("\t%s\tShould dial : %v", failed, err)
+		}
+		defer c.Close()
+
+		time.Sleep(30 * time.Millisecond)
+		s.Stop()
+
+		done := make(chan error)
+		go func() { done <- s.Wait() }()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("\t%s\tShould give up on the write.", failed)
+		}
+		t.Logf("\t%s\tShould give up on the write.", succeed)
+	}
+}
+
+// TestLimits validates the connection limit and the idle timeout.
+func TestLimits(t *testing.T) {
+	s := tcp.Server{
+		Handler:     echo(0),
+		MaxConns:    1,
+		IdleTimeout: 100 * time.Millisecond,
+	}
+	start(t, &s)
+	defer s.Close()
+
+	t.Log("Given the need to protect the server from its clients.")
+	{
+		first, _ := net.Dial("tcp", s.Addr().String())
+		defer first.Close()
+
+		if line, err := call(first, "one"); line != "ONE\n" {
+			t.Fatalf("\t%s\tShould serve the first connection : %q %v", failed, line, err)
+		}
+		t.Logf("\t%s\tShould serve the first connection.", succeed)
+
+		second, _ := net.Dial("tcp", s.Addr().String())
+		defer second.Close()
+
+		start := time.Now()
+		if line, err := call(second, "two"); line != "TWO\n" {
+			t.Fatalf("\t%s\tShould serve the second connection eventually : %q %v", failed, line, err)
+		}
+
+		// The second one is only accepted once the first is closed for being idle.
+		if time.Since(start) < 50*time.Millisecond {
+			t.Fatalf("\t%s\tShould wait for a free slot : %v", failed, time.Since(start))
+		}
+		t.Logf("\t%s\tShould wait for the idle connection to be closed.", succeed)
+
+		first.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := first.Read(make([]byte, 1)); err == nil {
+			t.Fatalf("\t%s\tShould have closed the idle connection.", failed)
+		}
+		t.Logf("\t%s\tShould have closed the idle connection.", succeed)
+	}
+}
@@ -0,0 +1,703 @@
+// Package unmarshal provides a JSON decoder that explains exactly where and why a document does
+// not fit the Go value it is decoded into.
+//
+// It is built on the error types from error_3.go. UnmarshalTypeError still carries the JSON value
+// that was found and the Go type that was expected, and now also the path to the value, like
+// .users[3].name, and its byte offset in the document. UnmarshalAll keeps going after a type error
+// and returns every one of them at once, so a config file can be fixed in one pass.
+package unmarshal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// An UnmarshalTypeError describes a JSON value that was not appropriate for
+// a value of a specific Go type.
+type UnmarshalTypeError struct {
+	Value  string       // description of JSON value, "string", "number 3.5", "object"...
+	Type   reflect.Type // type of Go value it could not be assigned to
+	Path   string       // path to the JSON value, like .users[3].name
+	Offset int64        // byte offset of the JSON value in the document
+}
+
+// Error implements the error interface.
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("json: cannot unmarshal %s into Go value of type %s at %s (offset %d)", e.Value, e.Type, e.path(), e.Offset)
+}
+
+// path returns the path, using . for the root of the document.
+func (e *UnmarshalTypeError) path() string {
+	if e.Path == "" {
+		return "."
+	}
+	return e.Path
+}
+
+// An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// (The argument to Unmarshal must be a non-nil pointer.)
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+// Error implements the error interface.
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "json: Unmarshal(nil)"
+	}
+
+	if e.Type.Kind() != reflect.Ptr {
+		return "json: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "json: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// A SyntaxError describes a document that is not valid JSON. Decoding stops at the first one.
+type SyntaxError struct {
+	msg    string
+	Offset int64 // byte offset where the error was found
+}
+
+// Error implements the error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("json: %s (offset %d)", e.msg, e.Offset)
+}
+
+// Errors is every type error found in a document, in document order.
+type Errors []error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors so errors.Is and errors.As look at each of them.
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Unmarshal parses the JSON document in data and stores the result in the value pointed to by v.
+// It returns the first error it finds. Values that could not be decoded keep their old content;
+// everything else is decoded.
+func Unmarshal(data []byte, v interface{}) error {
+	errs := decode(data, v)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs[0]
+}
+
+// UnmarshalAll is like Unmarshal but it reports every type error in the document. When there is
+// more than one, the error is an Errors value. A syntax error still stops decoding.
+func UnmarshalAll(data []byte, v interface{}) error {
+	errs := decode(data, v)
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	return errs
+}
+
+// decode runs the decoder and returns everything it found.
+func decode(data []byte, v interface{}) Errors {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return Errors{&InvalidUnmarshalError{reflect.TypeOf(v)}}
+	}
+
+	d := decoder{data: data}
+
+	// Decode into what v points to. The pointer itself can't be set, a top-level null would panic.
+	if err := d.value(rv.Elem(), ""); err != nil {
+		return append(d.errs, err)
+	}
+
+	d.skipSpace()
+	if d.off < len(d.data) {
+		return append(d.errs, d.syntax("invalid character %q after top-level value", d.data[d.off]))
+	}
+
+	return d.errs
+}
+
+// decoder walks the document once. Syntax errors are returned and stop the walk. Type errors are
+// collected in errs and the value is skipped.
+type decoder struct {
+	data []byte
+	off  int
+	errs Errors
+}
+
+// syntax returns a SyntaxError at the current offset.
+func (d *decoder) syntax(format string, args ...interface{}) error {
+	return &SyntaxError{
+		msg:    fmt.Sprintf(format, args...),
+		Offset: int64(d.off),
+	}
+}
+
+// mismatch records a type error for the value starting at off.
+func (d *decoder) mismatch(value string, t reflect.Type, path string, off int) {
+	d.errs = append(d.errs, &UnmarshalTypeError{
+		Value:  value,
+		Type:   t,
+		Path:   path,
+		Offset: int64(off),
+	})
+}
+
+// skipSpace moves past any white space.
+func (d *decoder) skipSpace() {
+	for d.off < len(d.data) {
+		switch d.data[d.off] {
+		case ' ', '\t', '\n', '\r':
+			d.off++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next byte that is not white space, or 0 at the end of the document.
+func (d *decoder) peek() byte {
+	d.skipSpace()
+	if d.off >= len(d.data) {
+		return 0
+	}
+	return d.data[d.off]
+}
+
+// value decodes the next JSON value into v. An invalid v means the value is parsed and thrown
+// away, that is how we skip over values we can't store.
+func (d *decoder) value(v reflect.Value, path string) error {
+	switch c := d.peek(); {
+	case c == 0:
+		return d.syntax("unexpected end of JSON input")
+	case c == '{':
+		return d.object(v, path)
+	case c == '[':
+		return d.array(v, path)
+	case c == '"':
+		return d.str(v, path)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return d.number(v, path)
+	case c == 't' || c == 'f' || c == 'n':
+		return d.literal(v, path)
+	default:
+		return d.syntax("invalid character %q looking for beginning of value", c)
+	}
+}
+
+// indirect walks down pointers, allocating them as needed, until it gets to a value that is not a
+// pointer. An empty interface holding nothing is returned as is.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// object decodes a JSON object into a struct, a map with string keys or an empty interface.
+func (d *decoder) object(v reflect.Value, path string) error {
+	start := d.off
+
+	var fields map[string]int
+	if v.IsValid() {
+		v = indirect(v)
+
+		switch {
+		case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+			m := make(map[string]interface{})
+			if err := d.members(func(key string, path string) error {
+				var elem interface{}
+				if err := d.value(reflect.ValueOf(&elem).Elem(), path); err != nil {
+					return err
+				}
+				m[key] = elem
+				return nil
+			}, path); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(m))
+			return nil
+
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+
+		case v.Kind() == reflect.Struct:
+			fields = fieldsOf(v.Type())
+
+		default:
+			d.mismatch("object", v.Type(), path, start)
+			v = reflect.Value{}
+		}
+	}
+
+	return d.members(func(key string, path string) error {
+		switch {
+		case !v.IsValid():
+			return d.value(reflect.Value{}, path)
+
+		case v.Kind() == reflect.Map:
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(elem, path); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+			return nil
+
+		default:
+			i, ok := fields[key]
+			if !ok {
+				i, ok = fold(fields, key)
+			}
+
+			// Unknown keys are skipped, like encoding/json does.
+			if !ok {
+				return d.value(reflect.Value{}, path)
+			}
+
+			return d.value(v.Field(i), path)
+		}
+	}, path)
+}
+
+// members parses the members of an object and calls fn with the key and path of each one. fn must
+// consume the value.
+func (d *decoder) members(fn func(key string, path string) error, path string) error {
+	d.off++ // {
+
+	if d.peek() == '}' {
+		d.off++
+		return nil
+	}
+
+	for {
+		if d.peek() != '"' {
+			return d.syntax("expected string for object key")
+		}
+
+		key, err := d.parseString()
+		if err != nil {
+			return err
+		}
+
+		if d.peek() != ':' {
+			return d.syntax("expected ':' after object key")
+		}
+		d.off++
+
+		if err := fn(key, path+"."+key); err != nil {
+			return err
+		}
+
+		switch d.peek() {
+		case ',':
+			d.off++
+		case '}':
+			d.off++
+			return nil
+		default:
+			return d.syntax("expected ',' or '}' after object member")
+		}
+	}
+}
+
+// array decodes a JSON array into a slice, an array or an empty interface.
+func (d *decoder) array(v reflect.Value, path string) error {
+	start := d.off
+
+	var generic []interface{}
+	if v.IsValid() {
+		v = indirect(v)
+
+		switch {
+		case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+			generic = []interface{}{}
+
+		case v.Kind() == reflect.Slice:
+			v.SetLen(0)
+
+		case v.Kind() == reflect.Array:
+
+		default:
+			d.mismatch("array", v.Type(), path, start)
+			v = reflect.Value{}
+		}
+	}
+
+	d.off++ // [
+
+	if d.peek() == ']' {
+		d.off++
+		if generic != nil {
+			v.Set(reflect.ValueOf(generic))
+		} else if v.IsValid() && v.Kind() == reflect.Slice && v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		elemPath := path + "[" + strconv.Itoa(i) + "]"
+
+		switch {
+		case generic != nil:
+			var elem interface{}
+			if err := d.value(reflect.ValueOf(&elem).Elem(), elemPath); err != nil {
+				return err
+			}
+			generic = append(generic, elem)
+
+		case v.IsValid() && v.Kind() == reflect.Slice:
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(elem, elemPath); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+
+		case v.IsValid() && v.Kind() == reflect.Array && i < v.Len():
+			if err := d.value(v.Index(i), elemPath); err != nil {
+				return err
+			}
+
+		default:
+			// Nowhere to put it, extra elements of a Go array are dropped.
+			if err := d.value(reflect.Value{}, elemPath); err != nil {
+				return err
+			}
+		}
+
+		switch d.peek() {
+		case ',':
+			d.off++
+		case ']':
+			d.off++
+			if generic != nil {
+				v.Set(reflect.ValueOf(generic))
+			}
+			return nil
+		default:
+			return d.syntax("expected ',' or ']' after array element")
+		}
+	}
+}
+
+// str decodes a JSON string into a string or an empty interface.
+func (d *decoder) str(v reflect.Value, path string) error {
+	start := d.off
+
+	s, err := d.parseString()
+	if err != nil || !v.IsValid() {
+		return err
+	}
+
+	v = indirect(v)
+
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(s))
+	default:
+		d.mismatch("string", v.Type(), path, start)
+	}
+
+	return nil
+}
+
+// number decodes a JSON number into any numeric kind or an empty interface.
+func (d *decoder) number(v reflect.Value, path string) error {
+	start := d.off
+
+	lit, err := d.parseNumber()
+	if err != nil || !v.IsValid() {
+		return err
+	}
+
+	v = indirect(v)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			d.mismatch("number "+lit, v.Type(), path, start)
+			return nil
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(lit, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			d.mismatch("number "+lit, v.Type(), path, start)
+			return nil
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(lit, v.Type().Bits())
+		if err != nil || v.OverflowFloat(n) {
+			d.mismatch("number "+lit, v.Type(), path, start)
+			return nil
+		}
+		v.SetFloat(n)
+
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			d.mismatch("number", v.Type(), path, start)
+			return nil
+		}
+
+		n, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			d.mismatch("number "+lit, v.Type(), path, start)
+			return nil
+		}
+		v.Set(reflect.ValueOf(n))
+
+	default:
+		d.mismatch("number", v.Type(), path, start)
+	}
+
+	return nil
+}
+
+// literal decodes true, false and null.
+func (d *decoder) literal(v reflect.Value, path string) error {
+	start := d.off
+
+	var word string
+	for _, w := range []string{"true", "false", "null"} {
+		if strings.HasPrefix(string(d.data[d.off:]), w) {
+			word = w
+			break
+		}
+	}
+
+	if word == "" {
+		return d.syntax("invalid literal")
+	}
+	d.off += len(word)
+
+	if !v.IsValid() {
+		return nil
+	}
+
+	// null sets anything that can be nil to nil and leaves everything else alone.
+	if word == "null" {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	b := word == "true"
+	v = indirect(v)
+
+	switch {
+	case v.Kind() == reflect.Bool:
+		v.SetBool(b)
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(b))
+	default:
+		d.mismatch("bool", v.Type(), path, start)
+	}
+
+	return nil
+}
+
+// parseString parses a quoted JSON string and returns its content.
+func (d *decoder) parseString() (string, error) {
+	d.off++ // "
+
+	var sb strings.Builder
+	for {
+		if d.off >= len(d.data) {
+			return "", d.syntax("unexpected end of JSON input in string")
+		}
+
+		c := d.data[d.off]
+		switch {
+		case c == '"':
+			d.off++
+			return sb.String(), nil
+
+		case c < 0x20:
+			return "", d.syntax("invalid control character in string")
+
+		case c == '\\':
+			r, err := d.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+
+		default:
+			r, size := utf8.DecodeRune(d.data[d.off:])
+			sb.WriteRune(r)
+			d.off += size
+		}
+	}
+}
+
+// parseEscape parses one escape sequence, including surrogate pairs.
+func (d *decoder) parseEscape() (rune, error) {
+	if d.off+1 >= len(d.data) {
+		return 0, d.syntax("unexpected end of JSON input in string escape")
+	}
+
+	c := d.data[d.off+1]
+	d.off += 2
+
+	switch c {
+	case '"', '\\', '/':
+		return rune(c), nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		r, err := d.parseHex()
+		if err != nil {
+			return 0, err
+		}
+
+		if utf16.IsSurrogate(r) && strings.HasPrefix(string(d.data[d.off:]), `\u`) {
+			d.off += 2
+			r2, err := d.parseHex()
+			if err != nil {
+				return 0, err
+			}
+			return utf16.DecodeRune(r, r2), nil
+		}
+
+		return r, nil
+	}
+
+	d.off -= 2
+	return 0, d.syntax("invalid escape character %q in string", c)
+}
+
+// parseHex parses the 4 hex digits of a \u escape.
+func (d *decoder) parseHex() (rune, error) {
+	if d.off+4 > len(d.data) {
+		return 0, d.syntax("unexpected end of JSON input in \\u escape")
+	}
+
+	n, err := strconv.ParseUint(string(d.data[d.off:d.off+4]), 16, 32)
+	if err != nil {
+		return 0, d.syntax("invalid \\u escape")
+	}
+	d.off += 4
+
+	return rune(n), nil
+}
+
+// parseNumber returns the literal of a JSON number after checking it follows the grammar.
+func (d *decoder) parseNumber() (string, error) {
+	start := d.off
+
+	digits := func() int {
+		n := 0
+		for d.off < len(d.data) && d.data[d.off] >= '0' && d.data[d.off] <= '9' {
+			d.off++
+			n++
+		}
+		return n
+	}
+
+	if d.data[d.off] == '-' {
+		d.off++
+	}
+
+	if d.off < len(d.data) && d.data[d.off] == '0' {
+		d.off++
+	} else if digits() == 0 {
+		return "", d.syntax("invalid number")
+	}
+
+	if d.off < len(d.data) && d.data[d.off] == '.' {
+		d.off++
+		if digits() == 0 {
+			return "", d.syntax("invalid number, expected digit after decimal point")
+		}
+	}
+
+	if d.off < len(d.data) && (d.data[d.off] == 'e' || d.data[d.off] == 'E') {
+		d.off++
+		if d.off < len(d.data) && (d.data[d.off] == '+' || d.data[d.off] == '-') {
+			d.off++
+		}
+		if digits() == 0 {
+			return "", d.syntax("invalid number, expected digit in exponent")
+		}
+	}
+
+	return string(d.data[start:d.off]), nil
+}
+
+// fieldsOf maps the JSON name of every exported field of a struct to its index. The name comes
+// from the json tag when there is one. Fields tagged "-" are left out.
+func fieldsOf(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fields[name] = i
+	}
+
+	return fields
+}
+
+// fold finds a field whose name matches key without regard to case.
+func fold(fields map[string]int, key string) (int, bool) {
+	for name, i := range fields {
+		if strings.EqualFold(name, key) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,177 @@
+// Run test using "go test -v"
+
+package unmarshal_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/unmarshal"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+type user struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Email *string  `json:"email"`
+	Tags  []string `json:"tags"`
+}
+
+type config struct {
+	Port  uint16                 `json:"port"`
+	Users []user                 `json:"users"`
+	Extra map[string]interface{} `json:"extra"`
+}
+
+// TestUnmarshal validates a valid document is decoded.
+func TestUnmarshal(t *testing.T) {
+	doc := `{"port": 8080, "users": [{"name": "Bill", "age": 40, "email": "bill@example.com", "tags": ["a", "é"]}], "extra": {"debug": true, "n": 1.5, "list": [null]}}`
+
+	t.Log("Given the need to decode a valid document.")
+	{
+		var c config
+		if err := unmarshal.Unmarshal([]byte(doc), &c); err != nil {
+			t.Fatalf("\t%s\tShould decode without error : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould decode without error.", succeed)
+
+		email := "bill@example.com"
+		want := config{
+			Port:  8080,
+			Users: []user{{Name: "Bill", Age: 40, Email: &email, Tags: []string{"a", "é"}}},
+			Extra: map[string]interface{}{"debug": true, "n": 1.5, "list": []interface{}{nil}},
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Fatalf("\t%s\tShould decode every value : %+v", failed, c)
+		}
+		t.Logf("\t%s\tShould decode every value.", succeed)
+	}
+}
+
+// TestUnmarshalAll validates every type error is reported with its path and offset.
+func TestUnmarshalAll(t *testing.T) {
+	doc := `{"port": 70000, "users": [{"name": "Bill"}, {"name": 7, "age": "40"}]}`
+
+	t.Log("Given the need to report every type error in a document.")
+	{
+		var c config
+		err := unmarshal.UnmarshalAll([]byte(doc), &c)
+
+		var errs unmarshal.Errors
+		if !errors.As(err, &errs) || len(errs) != 3 {
+			t.Fatalf("\t%s\tShould get 3 errors : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould get 3 errors.", succeed)
+
+		tests := []struct {
+			value  string
+			path   string
+			offset int64
+		}{
+			{"number 70000", ".port", 9},
+			{"number", ".users[1].name", 53},
+			{"string", ".users[1].age", 63},
+		}
+
+		for i, tt := range tests {
+			var ute *unmarshal.UnmarshalTypeError
+			if !errors.As(errs[i], &ute) || ute.Value != tt.value || ute.Path != tt.path || ute.Offset != tt.offset {
+				t.Errorf("\t%s\tShould report %s at %s offset %d : %v", failed, tt.value, tt.path, tt.offset, errs[i])
+				continue
+			}
+			t.Logf("\t%s\tShould report %s at %s offset %d.", succeed, tt.value, tt.path, tt.offset)
+		}
+
+		if c.Users[0].Name != "Bill" || len(c.Users) != 2 {
+			t.Errorf("\t%s\tShould still decode the good values : %+v", failed, c)
+		} else {
+			t.Logf("\t%s\tShould still decode the good values.", succeed)
+		}
+
+		if err := unmarshal.Unmarshal([]byte(doc), &c); err == nil || err.Error() != errs[0].Error() {
+			t.Errorf("\t%s\tShould get the first error from Unmarshal : %v", failed, err)
+		} else {
+			t.Logf("\t%s\tShould get the first error from Unmarshal.", succeed)
+		}
+	}
+}
+
+// TestInvalid validates bad arguments and bad documents.
+func TestInvalid(t *testing.T) {
+	t.Log("Given the need to reject what can't be decoded.")
+	{
+		t.Logf("\tTest 0:\tWhen passing a non-pointer.")
+		{
+			var iue *unmarshal.InvalidUnmarshalError
+			if err := unmarshal.Unmarshal([]byte(`{}`), config{}); !errors.As(err, &iue) {
+				t.Fatalf("\t%s\tShould get an InvalidUnmarshalError : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould get an InvalidUnmarshalError.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen the document is not valid JSON.")
+		{
+			var c config
+			var se *unmarshal.SyntaxError
+			err := unmarshal.UnmarshalAll([]byte(`{"port": 1,, }`), &c)
+			if !errors.As(err, &se) || se.Offset != 11 {
+				t.Fatalf("\t%s\tShould get a SyntaxError at offset 11 : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould get a SyntaxError at offset 11.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen the document is a top-level null.")
+		{
+			c := config{Port: 80}
+			if err := unmarshal.Unmarshal([]byte(" null "), &c); err != nil || c.Port != 80 {
+				t.Fatalf("\t%s\tShould leave the struct alone : %v %+v", failed, err, c)
+			}
+			t.Logf("\t%s\tShould leave the struct alone.", succeed)
+
+			p := &c
+			if err := unmarshal.Unmarshal([]byte("null"), &p); err != nil || p != nil {
+				t.Fatalf("\t%s\tShould set the pointer to nil : %v %v", failed, err, p)
+			}
+			t.Logf("\t%s\tShould set the pointer to nil.", succeed)
+
+			var se *unmarshal.SyntaxError
+			if err := unmarshal.Unmarshal([]byte("null0"), &c); !errors.As(err, &se) {
+				t.Fatalf("\t%s\tShould get a SyntaxError after null : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould get a SyntaxError after null.", succeed)
+		}
+	}
+}
+
+// FuzzUnmarshal validates the decoder never panics and agrees with encoding/json on what is valid.
+// Run: go test -run none -fuzz FuzzUnmarshal
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range []string{
+		`{"port": 8080, "users": [{"name": "Bill", "tags": ["a"]}], "extra": {"n": 1.5}}`,
+		`{"port": 1,, }`,
+		`[1, "a", true, null]`,
+		`null`,
+		` null `,
+		`null0`,
+		`"\u00e9"`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var c config
+		err := unmarshal.UnmarshalAll(data, &c)
+
+		var v interface{}
+		var se *unmarshal.SyntaxError
+		if valid := json.Unmarshal(data, &v) == nil; valid == errors.As(err, &se) {
+			t.Fatalf("valid JSON is %v, got %v", valid, err)
+		}
+	})
+}
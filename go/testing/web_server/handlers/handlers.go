@@ -3,14 +3,32 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 )
 
-// Routes sets the routes for the web service.
-// It has 1 route call sendjson. When that route is executed, it will call the SendJSON function.
+// Routes sets the routes for the web service on http.DefaultServeMux.
+// It has 2 routes. When sendjson is executed, it will call the SendJSON function. When echojson is
+// executed, it will call the EchoJSON function, which returns an error instead of writing an
+// error response itself. Both go through the routes of API, so they only accept their method.
 func Routes() {
-	http.HandleFunc("/sendjson", SendJSON)
+	api := API()
+	http.Handle("/sendjson", api)
+	http.Handle("/echojson", api)
+}
+
+// API returns the routes for the web service in a handler of their own, so nothing is shared with
+// other tests or packages. On top of the routes above it has users/{id}, which calls GetUser, and
+// every route only accepts its method.
+func API() http.Handler {
+	r := NewRouter()
+	r.HandleFunc("GET", "/sendjson", SendJSON)
+	r.Handle("POST", "/echojson", HandlerFunc(EchoJSON))
+	r.Handle("GET", "/users/{id}", HandlerFunc(GetUser))
+
+	return r
 }
 
 // SendJSON returns a simple JSON document.
@@ -30,3 +48,61 @@ func SendJSON(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(200)
 	json.NewEncoder(rw).Encode(&u)
 }
+
+// users are the users GetUser knows about, by id.
+var users = map[string]struct {
+	Name  string
+	Email string
+}{
+	"1": {Name: "Hoanh An", Email: "hoanhan101@gmail.com"},
+}
+
+// GetUser sends the user with the id in the path, or a 404 problem when there is none.
+func GetUser(rw http.ResponseWriter, r *http.Request) error {
+	id := Param(r, "id")
+
+	u, ok := users[id]
+	if !ok {
+		return NewProblem(http.StatusNotFound, "no user with id "+id)
+	}
+
+	return respond(rw, 200, &u)
+}
+
+// EchoJSON decodes the user in the request body and sends it back.
+// Every failure is returned as an error and HandlerFunc decides what the client sees. The router
+// only sends it POST requests.
+func EchoJSON(rw http.ResponseWriter, r *http.Request) error {
+	var u struct {
+		Name  string
+		Email string
+	}
+
+	// An empty or cut off body is the client's fault, but the decoder can't tell us that.
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrBadRequest
+		}
+		return err
+	}
+
+	return respond(rw, 200, &u)
+}
+
+// respond sends v as JSON with the status code. It encodes v before writing anything, so when
+// encoding fails the handler can still return the error and HandlerFunc has a clean response to
+// write the problem to.
+func respond(rw http.ResponseWriter, status int, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	// Past this point an error can't become a problem response anymore. A failed write means the
+	// client is gone anyway.
+	buf.WriteTo(rw)
+	return nil
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// These are the error variables from error_2.go. Handlers return them and HandlerFunc turns them
+// into the right response.
+var (
+	// ErrBadRequest is returned when there are problems with the request.
+	ErrBadRequest = errors.New("Bad Request")
+
+	// ErrPageMoved is returned when a 301/302 is returned. A redirect needs a Location, which an
+	// error variable can't carry, so handlers return it inside a Moved.
+	ErrPageMoved = errors.New("Page Moved")
+)
+
+// Moved is ErrPageMoved with the Location the page moved to. errors.Is(err, ErrPageMoved) reports
+// true for it.
+type Moved struct {
+	Location string
+}
+
+// Error implements the error interface.
+func (m *Moved) Error() string {
+	return ErrPageMoved.Error() + ": " + m.Location
+}
+
+// Is makes a Moved match ErrPageMoved.
+func (m *Moved) Is(target error) bool {
+	return target == ErrPageMoved
+}
+
+// The details of the classified errors. They are fixed, the message of an error we only know by
+// its behavior is not ours to show the client.
+const (
+	detailNotFound = "the resource does not exist"
+	detailConflict = "the resource was changed by another request"
+)
+
+// Problem is an RFC 7807 problem details document. It is also an error, so a handler that needs
+// full control over the response can return one directly.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Field is an extension member naming the JSON field that could not be decoded.
+	Field string `json:"field,omitempty"`
+
+	// Location is sent as the Location header, for a redirect.
+	Location string `json:"-"`
+}
+
+// NewProblem returns a Problem for the status code with the standard title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.Status, p.Title)
+	}
+
+	return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+}
+
+// ProblemFor maps an error to the Problem that describes it to the client.
+// We go from the most specific context to the least:
+// - A Problem anywhere in the chain is used as is.
+// - A Moved is a 301 to its Location. ErrPageMoved on its own has nowhere to send the client, so it
+//   is a 500 like any error we can't answer.
+// - The error variables are matched by value.
+// - The json error types are matched by type, this is type as context from error_3.go.
+// - Anything else is matched by behavior through errors.Classify, with a fixed detail per class.
+// Errors we know nothing about become a 500. Neither they nor the classified errors leak their
+// message to the client.
+func ProblemFor(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var m *Moved
+	if errors.As(err, &m) {
+		p := NewProblem(http.StatusMovedPermanently, "")
+		p.Location = m.Location
+		return p
+	}
+
+	if errors.Is(err, ErrBadRequest) {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		p := NewProblem(http.StatusBadRequest, fmt.Sprintf("cannot use %s as %v", ute.Value, ute.Type))
+		p.Field = ute.Field
+		return p
+	}
+
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return NewProblem(http.StatusBadRequest, fmt.Sprintf("malformed JSON at offset %d", se.Offset))
+	}
+
+	c := errors.Classify(err)
+	switch {
+	case c.Has(errors.NotFound):
+		return NewProblem(http.StatusNotFound, detailNotFound)
+
+	case c.Has(errors.Conflict):
+		return NewProblem(http.StatusConflict, detailConflict)
+
+	case c.Has(errors.Timeout):
+		return NewProblem(http.StatusGatewayTimeout, "")
+
+	case c.Has(errors.Temporary):
+		return NewProblem(http.StatusServiceUnavailable, "")
+	}
+
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// HandlerFunc is a handler that returns an error instead of writing the error response itself.
+// It implements http.Handler, so it can be registered like any other handler.
+type HandlerFunc func(rw http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls f and turns any error it returns into a problem+json response. The handler must
+// not have written anything when it returns an error.
+func (f HandlerFunc) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	err := f(rw, r)
+	if err == nil {
+		return
+	}
+
+	p := *ProblemFor(err)
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	// Only the errors we did not expect are worth a log line.
+	if p.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s : %+v", r.Method, r.URL.Path, err)
+	}
+
+	if p.Location != "" {
+		rw.Header().Set("Location", p.Location)
+	}
+	rw.Header().Set("Content-Type", "application/problem+json")
+	rw.WriteHeader(p.Status)
+	json.NewEncoder(rw).Encode(&p)
+}
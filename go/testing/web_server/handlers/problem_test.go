@@ -0,0 +1,169 @@
+// ----------------------
+// Error to problem tests
+// ----------------------
+
+// Below is how to test that the errors our handlers return become the right problem+json
+// response.
+
+// Run test using "go test -run 'TestEchoJSON|TestProblemFor|TestMoved'"
+
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+	"github.com/hoanhan101/ultimate-go/go/testing/web_server/handlers"
+)
+
+// TestEchoJSON testing the echojson internal endpoint and its error responses.
+func TestEchoJSON(t *testing.T) {
+	url := "/echojson"
+
+	tests := []struct {
+		method     string
+		body       string
+		statusCode int
+		field      string
+		allow      string
+	}{
+		{"POST", `{"Name":"Hoanh An","Email":"hoanhan101@gmail.com"}`, http.StatusOK, "", ""},
+		{"GET", ``, http.StatusMethodNotAllowed, "", "POST"},
+		{"POST", `{"Name":101}`, http.StatusBadRequest, "Name", ""},
+		{"POST", `{"Name":`, http.StatusBadRequest, "", ""},
+		{"POST", `{"Name"}`, http.StatusBadRequest, "", ""},
+	}
+
+	t.Log("Given the need to test the EchoJSON endpoint.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen sending %s %q to %q for status code %d", i, tt.method, tt.body, url, tt.statusCode)
+			{
+				r := httptest.NewRequest(tt.method, url, strings.NewReader(tt.body))
+				w := httptest.NewRecorder()
+				http.DefaultServeMux.ServeHTTP(w, r)
+
+				if w.Code != tt.statusCode {
+					t.Fatalf("\t%s\tShould receive a status code of %d for the response. Received[%d].", failed, tt.statusCode, w.Code)
+				}
+				t.Logf("\t%s\tShould receive a status code of %d for the response.", succeed, tt.statusCode)
+
+				if tt.statusCode == http.StatusOK {
+					continue
+				}
+
+				if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Fatalf("\t%s\tShould receive a problem+json response : %q", failed, ct)
+				}
+				t.Logf("\t%s\tShould receive a problem+json response.", succeed)
+
+				if allow := w.Header().Get("Allow"); allow != tt.allow {
+					t.Fatalf("\t%s\tShould have Allow %q : %q", failed, tt.allow, allow)
+				}
+				t.Logf("\t%s\tShould have Allow %q.", succeed, tt.allow)
+
+				var p handlers.Problem
+				if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+					t.Fatalf("\t%s\tShould be able to decode the problem.", failed)
+				}
+				t.Logf("\t%s\tShould be able to decode the problem.", succeed)
+
+				if p.Status != tt.statusCode || p.Instance != url || p.Field != tt.field {
+					t.Errorf("\t%s\tShould have status %d, instance %q and field %q : %+v", failed, tt.statusCode, url, tt.field, p)
+				} else {
+					t.Logf("\t%s\tShould have status %d, instance %q and field %q.", succeed, tt.statusCode, url, tt.field)
+				}
+			}
+		}
+	}
+}
+
+// behavior is an error with the behaviors errors.Classify asks about.
+type behavior struct {
+	msg                                    string
+	notFound, conflict, timeout, temporary bool
+}
+
+func (b *behavior) Error() string   { return b.msg }
+func (b *behavior) NotFound() bool  { return b.notFound }
+func (b *behavior) Conflict() bool  { return b.conflict }
+func (b *behavior) Timeout() bool   { return b.timeout }
+func (b *behavior) Temporary() bool { return b.temporary }
+
+// TestProblemFor validates every kind of error ProblemFor knows is mapped to its status and detail.
+func TestProblemFor(t *testing.T) {
+	var ute *json.UnmarshalTypeError
+	err := json.Unmarshal([]byte(`{"Name":101}`), &struct{ Name string }{})
+	errors.As(err, &ute)
+
+	var se *json.SyntaxError
+	err = json.Unmarshal([]byte(`{"Name"}`), &struct{ Name string }{})
+	errors.As(err, &se)
+
+	teapot := handlers.NewProblem(http.StatusTeapot, "short and stout")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{"a Problem", teapot, http.StatusTeapot, "short and stout"},
+		{"a wrapped Problem", fmt.Errorf("brew: %w", teapot), http.StatusTeapot, "short and stout"},
+		{"ErrBadRequest", handlers.ErrBadRequest, http.StatusBadRequest, "Bad Request"},
+		{"a wrapped ErrBadRequest", errors.Wrap(handlers.ErrBadRequest, "decode"), http.StatusBadRequest, "decode: Bad Request"},
+		{"a Moved", &handlers.Moved{Location: "/v2/users"}, http.StatusMovedPermanently, ""},
+		{"ErrPageMoved with no Location", handlers.ErrPageMoved, http.StatusInternalServerError, ""},
+		{"a json type error", ute, http.StatusBadRequest, "cannot use number as string"},
+		{"a json syntax error", se, http.StatusBadRequest, "malformed JSON at offset 8"},
+		{"a not found error", &behavior{msg: "user 42 in table users", notFound: true}, http.StatusNotFound, "the resource does not exist"},
+		{"a conflict error", &behavior{msg: "version 3 of row 42", conflict: true}, http.StatusConflict, "the resource was changed by another request"},
+		{"a timeout error", &behavior{msg: "dial db:5432", timeout: true}, http.StatusGatewayTimeout, ""},
+		{"a temporary error", &behavior{msg: "dial db:5432", temporary: true}, http.StatusServiceUnavailable, ""},
+		{"an unknown error", errors.New("password is hunter2"), http.StatusInternalServerError, ""},
+	}
+
+	t.Log("Given the need to describe every error to the client.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen the handler returns %s.", i, tt.name)
+			{
+				p := handlers.ProblemFor(tt.err)
+
+				if p.Status != tt.status || p.Detail != tt.detail || p.Type != "about:blank" || p.Title != http.StatusText(tt.status) {
+					t.Errorf("\t%s\tShould be a %d with detail %q : %+v", failed, tt.status, tt.detail, p)
+					continue
+				}
+				t.Logf("\t%s\tShould be a %d with detail %q.", succeed, tt.status, tt.detail)
+			}
+		}
+	}
+}
+
+// TestMoved validates a moved page is a redirect to its new location.
+func TestMoved(t *testing.T) {
+	h := handlers.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+		return errors.Wrap(&handlers.Moved{Location: "/v2/users"}, "users")
+	})
+
+	t.Log("Given the need to send the client to the new location of a page.")
+	{
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/v2/users" {
+			t.Fatalf("\t%s\tShould redirect to /v2/users : %d %q", failed, w.Code, w.Header().Get("Location"))
+		}
+		t.Logf("\t%s\tShould redirect to /v2/users.", succeed)
+
+		if err := error(&handlers.Moved{}); !errors.Is(err, handlers.ErrPageMoved) {
+			t.Fatalf("\t%s\tShould match ErrPageMoved.", failed)
+		}
+		t.Logf("\t%s\tShould match ErrPageMoved.", succeed)
+	}
+}
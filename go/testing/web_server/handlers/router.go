@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Routes registers on http.DefaultServeMux, which every test and every package in the program
+// shares. A Router is a value of its own: API builds one and returns it as an http.Handler, and a
+// test can build as many as it wants.
+//
+// Patterns are paths made of segments. A segment in braces is a parameter that matches any one
+// segment, and the handler reads its value with Param:
+//
+//	r.Handle("GET", "/users/{id}", h)     GET /users/42 calls h with Param(r, "id") == "42"
+//
+// A literal segment wins over a parameter, so /users/me can be registered next to /users/{id}. It
+// only wins for the methods it has, the others still go to the parameter. When the path matches
+// but not the method, the response is a 405 with the Allow header.
+
+// Middleware wraps a handler to run code before and after it, like logging or authentication.
+type Middleware func(http.Handler) http.Handler
+
+// Router matches the method and path of a request to a handler.
+type Router struct {
+	t      *tree
+	prefix string
+	mw     []Middleware
+}
+
+// tree holds the routes of a router and of all its groups.
+type tree struct {
+	mu   sync.RWMutex
+	root segment
+}
+
+// segment is one segment of the registered patterns.
+type segment struct {
+	literals map[string]*segment
+	param    *segment
+	name     string                  // name of the parameter, when this is one
+	handlers map[string]http.Handler // by method, for the patterns ending here
+}
+
+// NewRouter returns a Router with no routes.
+func NewRouter() *Router {
+	return &Router{t: &tree{}}
+}
+
+// Use adds middleware to the routes registered after this call and to the 404 and 405 responses.
+// The first middleware added is the outermost one, the first to see the request.
+func (rt *Router) Use(mw ...Middleware) {
+	rt.mw = append(rt.mw, mw...)
+}
+
+// Group returns a router that registers its routes on rt with prefix in front of their patterns.
+// They run the middleware of rt and then mw. Calling Use on the group does not change rt.
+func (rt *Router) Group(prefix string, mw ...Middleware) *Router {
+	g := Router{
+		t:      rt.t,
+		prefix: rt.prefix + strings.TrimSuffix(prefix, "/"),
+	}
+	g.mw = append(g.mw, rt.mw...)
+	g.mw = append(g.mw, mw...)
+
+	return &g
+}
+
+// Handle registers h for the method and pattern. Like http.ServeMux, it panics when the pattern is
+// invalid or already registered for the method.
+func (rt *Router) Handle(method, pattern string, h http.Handler) {
+	pattern = rt.prefix + pattern
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("handlers: pattern %q must start with /", pattern))
+	}
+
+	h = rt.wrap(h)
+
+	rt.t.mu.Lock()
+	defer rt.t.mu.Unlock()
+
+	s := &rt.t.root
+	for _, seg := range segments(pattern) {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := seg[1 : len(seg)-1]
+			if name == "" {
+				panic(fmt.Sprintf("handlers: pattern %q has a parameter with no name", pattern))
+			}
+
+			if s.param == nil {
+				s.param = &segment{name: name}
+			} else if s.param.name != name {
+				panic(fmt.Sprintf("handlers: parameter {%s} in %q conflicts with {%s}", name, pattern, s.param.name))
+			}
+			s = s.param
+			continue
+		}
+
+		if s.literals == nil {
+			s.literals = make(map[string]*segment)
+		}
+
+		child, ok := s.literals[seg]
+		if !ok {
+			child = &segment{}
+			s.literals[seg] = child
+		}
+		s = child
+	}
+
+	if _, ok := s.handlers[method]; ok {
+		panic(fmt.Sprintf("handlers: %s %s registered twice", method, pattern))
+	}
+	if s.handlers == nil {
+		s.handlers = make(map[string]http.Handler)
+	}
+	s.handlers[method] = h
+}
+
+// HandleFunc registers the handler function for the method and pattern.
+func (rt *Router) HandleFunc(method, pattern string, f func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(method, pattern, http.HandlerFunc(f))
+}
+
+// ServeHTTP calls the handler registered for the method and path of the request. When there is
+// none it responds with a problem+json 404, or a 405 if only the method is wrong. Those responses
+// go through the middleware of rt too.
+func (rt *Router) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	params := make(map[string]string)
+	allow := make(map[string]bool)
+
+	rt.t.mu.RLock()
+	h := rt.t.root.match(segments(r.URL.Path), r.Method, params, allow)
+	rt.t.mu.RUnlock()
+
+	switch {
+	case h != nil:
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), paramsKey, params))
+		}
+		h.ServeHTTP(rw, r)
+
+	case len(allow) > 0:
+		methods := make([]string, 0, len(allow))
+		for method := range allow {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		rw.Header().Set("Allow", strings.Join(methods, ", "))
+		rt.wrap(notAllowed).ServeHTTP(rw, r)
+
+	default:
+		rt.wrap(notFound).ServeHTTP(rw, r)
+	}
+}
+
+// wrap returns h inside the middleware of rt.
+func (rt *Router) wrap(h http.Handler) http.Handler {
+	for i := len(rt.mw) - 1; i >= 0; i-- {
+		h = rt.mw[i](h)
+	}
+
+	return h
+}
+
+// ctxKey is the type of the keys this package stores in a request context. Having our own type
+// means no other package can use the same key by accident, see context_1.go.
+type ctxKey int
+
+// paramsKey is the key the path parameters are stored under.
+const paramsKey ctxKey = 0
+
+// Param returns the value of the path parameter name in the request, or "" when the pattern that
+// matched has no such parameter.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+// notFound and notAllowed answer the requests with no handler, in the same format as the errors
+// the handlers return.
+var (
+	notFound = HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+		return NewProblem(http.StatusNotFound, "")
+	})
+
+	notAllowed = HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+		return NewProblem(http.StatusMethodNotAllowed, r.Method+" is not allowed")
+	})
+)
+
+// segments splits a path on its slashes. "/" is one empty segment, and a trailing slash adds one,
+// so /users and /users/ are different paths.
+func segments(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// match returns the handler for method of the pattern matching segs, or nil when there is none.
+// It fills params with the values of the parameters on the way, and allow with the methods of the
+// patterns that match segs but not method.
+func (s *segment) match(segs []string, method string, params map[string]string, allow map[string]bool) http.Handler {
+	if len(segs) == 0 {
+		if h := s.handler(method); h != nil {
+			return h
+		}
+
+		for m := range s.handlers {
+			allow[m] = true
+			if m == http.MethodGet {
+				allow[http.MethodHead] = true
+			}
+		}
+		return nil
+	}
+
+	// Try the literal first, and the parameter when nothing under the literal has a handler for the
+	// method. With GET /users/me and DELETE /users/{id}, DELETE /users/me goes to {id}.
+	if child, ok := s.literals[segs[0]]; ok {
+		if h := child.match(segs[1:], method, params, allow); h != nil {
+			return h
+		}
+	}
+
+	if s.param != nil && segs[0] != "" {
+		if h := s.param.match(segs[1:], method, params, allow); h != nil {
+			params[s.param.name] = segs[0]
+			return h
+		}
+	}
+
+	return nil
+}
+
+// handler returns the handler registered on s for method. Like http.ServeMux, a GET handler also
+// answers HEAD.
+func (s *segment) handler(method string) http.Handler {
+	if h, ok := s.handlers[method]; ok {
+		return h
+	}
+
+	if method == http.MethodHead {
+		return s.handlers[http.MethodGet]
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// ------------
+// Router tests
+// ------------
+
+// Below is how to test routes that live in a handler of their own. Every test builds its own
+// Router, so nothing is registered on http.DefaultServeMux and the tests can't see each other's
+// routes.
+
+// Run test using "go test -run TestRouter"
+
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/testing/web_server/handlers"
+)
+
+// TestRouter validates how requests are matched to the routes.
+func TestRouter(t *testing.T) {
+	r := handlers.NewRouter()
+	r.HandleFunc("GET", "/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "user "+handlers.Param(r, "id"))
+	})
+	r.HandleFunc("GET", "/users/me", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "me")
+	})
+	r.HandleFunc("DELETE", "/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "deleted "+handlers.Param(r, "id"))
+	})
+	r.HandleFunc("GET", "/users/{id}/posts/{post}", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "post "+handlers.Param(r, "post")+" of "+handlers.Param(r, "id"))
+	})
+
+	tests := []struct {
+		method     string
+		url        string
+		statusCode int
+		body       string
+		allow      string
+	}{
+		{"GET", "/users/42", http.StatusOK, "user 42", ""},
+		{"GET", "/users/me", http.StatusOK, "me", ""},
+		{"DELETE", "/users/42", http.StatusOK, "deleted 42", ""},
+		{"GET", "/users/42/posts/7", http.StatusOK, "post 7 of 42", ""},
+		{"HEAD", "/users/42", http.StatusOK, "user 42", ""},
+		{"DELETE", "/users/me", http.StatusOK, "deleted me", ""},
+		{"POST", "/users/42", http.StatusMethodNotAllowed, "", "DELETE, GET, HEAD"},
+		{"PUT", "/users/me", http.StatusMethodNotAllowed, "", "DELETE, GET, HEAD"},
+		{"GET", "/users", http.StatusNotFound, "", ""},
+		{"GET", "/users/", http.StatusNotFound, "", ""},
+		{"GET", "/users/42/posts", http.StatusNotFound, "", ""},
+	}
+
+	t.Log("Given the need to route requests by method and path.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen checking %s %q for status code %d", i, tt.method, tt.url, tt.statusCode)
+			{
+				req := httptest.NewRequest(tt.method, tt.url, nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != tt.statusCode {
+					t.Fatalf("\t%s\tShould receive a status code of %d for the response. Received[%d].", failed, tt.statusCode, w.Code)
+				}
+				t.Logf("\t%s\tShould receive a status code of %d for the response.", succeed, tt.statusCode)
+
+				if tt.statusCode == http.StatusOK {
+					if w.Body.String() != tt.body {
+						t.Fatalf("\t%s\tShould receive %q : %q", failed, tt.body, w.Body.String())
+					}
+					t.Logf("\t%s\tShould receive %q.", succeed, tt.body)
+					continue
+				}
+
+				if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Fatalf("\t%s\tShould receive a problem+json response : %q", failed, ct)
+				}
+				t.Logf("\t%s\tShould receive a problem+json response.", succeed)
+
+				if allow := w.Header().Get("Allow"); allow != tt.allow {
+					t.Fatalf("\t%s\tShould have Allow %q : %q", failed, tt.allow, allow)
+				}
+				t.Logf("\t%s\tShould have Allow %q.", succeed, tt.allow)
+			}
+		}
+	}
+}
+
+// TestGroup validates the prefix and the middleware of route groups.
+func TestGroup(t *testing.T) {
+	var calls []string
+	mark := func(name string) handlers.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(rw, r)
+			})
+		}
+	}
+
+	r := handlers.NewRouter()
+	r.Use(mark("log"))
+
+	v1 := r.Group("/v1", mark("auth"))
+	v1.HandleFunc("GET", "/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "user "+handlers.Param(r, "id"))
+	})
+	r.HandleFunc("GET", "/health", func(rw http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "health")
+	})
+
+	tests := []struct {
+		url   string
+		calls string
+	}{
+		{"/v1/users/42", "log auth user 42"},
+		{"/health", "log health"},
+		{"/missing", "log"},
+	}
+
+	t.Log("Given the need to group routes under a prefix and middleware.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen checking %q.", i, tt.url)
+			{
+				calls = nil
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+				if got := strings.Join(calls, " "); got != tt.calls {
+					t.Fatalf("\t%s\tShould call %q : %q", failed, tt.calls, got)
+				}
+				t.Logf("\t%s\tShould call %q.", succeed, tt.calls)
+			}
+		}
+	}
+}
+
+// TestAPI validates the routes of the web service through API, without http.DefaultServeMux.
+func TestAPI(t *testing.T) {
+	api := handlers.API()
+
+	tests := []struct {
+		method     string
+		url        string
+		statusCode int
+	}{
+		{"GET", "/sendjson", http.StatusOK},
+		{"GET", "/users/1", http.StatusOK},
+		{"GET", "/users/2", http.StatusNotFound},
+		{"GET", "/echojson", http.StatusMethodNotAllowed},
+	}
+
+	t.Log("Given the need to test the routes returned by API.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen checking %s %q for status code %d", i, tt.method, tt.url, tt.statusCode)
+			{
+				w := httptest.NewRecorder()
+				api.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+
+				if w.Code != tt.statusCode {
+					t.Fatalf("\t%s\tShould receive a status code of %d for the response. Received[%d].", failed, tt.statusCode, w.Code)
+				}
+				t.Logf("\t%s\tShould receive a status code of %d for the response.", succeed, tt.statusCode)
+
+				if tt.statusCode != http.StatusOK {
+					continue
+				}
+
+				var u struct {
+					Name  string
+					Email string
+				}
+				if err := json.NewDecoder(w.Body).Decode(&u); err != nil || u.Name != "Hoanh An" {
+					t.Fatalf("\t%s\tShould receive the user : %v %+v", failed, err, u)
+				}
+				t.Logf("\t%s\tShould receive the user.", succeed)
+			}
+		}
+	}
+}
@@ -16,8 +16,8 @@ import (
 )
 
 func main() {
-	handlers.Routes()
-
+	// API returns the routes in a handler of their own instead of registering them on
+	// http.DefaultServeMux, so we pass it to the server rather than nil.
 	log.Println("listener : Started : Listening on: http://localhost:4000")
-	http.ListenAndServe(":4000", nil)
+	http.ListenAndServe(":4000", handlers.API())
 }